@@ -6,6 +6,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 //  add-node        new_host:new_port existing_host:existing_port
@@ -36,7 +37,7 @@ var addNodeCommand = cli.Command{
 		if context.NArg() < 2 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "add-node")
-			logrus.Fatalf("Must provide \"new_host:new_port existing_host:existing_port\" for add-node command!")
+			return badArgument("Must provide \"new_host:new_port existing_host:existing_port\" for add-node command!")
 		}
 
 		rt := NewRedisTrib()
@@ -51,7 +52,7 @@ func (self *RedisTrib) AddNodeClusterCmd(context *cli.Context) error {
 	var newaddr string
 	var addr string
 	var masterID string
-	var master *ClusterNode
+	var master *redistrib.ClusterNode
 
 	if newaddr = context.Args().Get(0); newaddr == "" {
 		return errors.New("please check new_host:new_port for add-node command")
@@ -65,7 +66,9 @@ func (self *RedisTrib) AddNodeClusterCmd(context *cli.Context) error {
 	if err := self.LoadClusterInfoFromNode(addr); err != nil {
 		return err
 	}
-	self.CheckCluster(false)
+	if err := self.CheckCluster(false); err != nil {
+		return err
+	}
 
 	// If --master-id was specified, try to resolve it now so that we
 	// abort before starting with the node configuration.
@@ -74,48 +77,61 @@ func (self *RedisTrib) AddNodeClusterCmd(context *cli.Context) error {
 		if masterID != "" {
 			master = self.GetNodeByName(masterID)
 			if master == nil {
-				logrus.Errorf("No such master ID %s", masterID)
+				return badArgument("No such master ID %s", masterID)
 			}
 		} else {
 			master = self.GetMasterWithLeastReplicas()
 			if master == nil {
-				logrus.Errorf("Can't selected a master node!")
+				return badArgument("Can't selected a master node!")
 			} else {
 				logrus.Printf("Automatically selected master %s", master.String())
 			}
 		}
 	}
 
-	// Add the new node
-	newNode := NewClusterNode(newaddr)
-	newNode.Connect(true)
+	if _, err := self.JoinNode(newaddr, addr, master); err != nil {
+		return err
+	}
+	logrus.Printf("[OK] New node added correctly.")
+	return nil
+}
+
+// Make the empty node at newaddr meet the cluster of the node at addr,
+// then replicate the master if not nil.
+func (self *RedisTrib) JoinNode(newaddr, addr string, master *redistrib.ClusterNode) (*redistrib.ClusterNode, error) {
+	newNode, err := self.NewNode(newaddr)
+	if err != nil {
+		return nil, err
+	}
+	if err := newNode.Connect(); err != nil {
+		return nil, err
+	}
 	if !newNode.AssertCluster() { // quit if not in cluster mode
-		logrus.Fatalf("Node %s is not configured as a cluster node.", newNode.String())
+		return nil, redistrib.NewError(redistrib.ErrNotClusterNode, newNode.String(), nil, "Node is not configured as a cluster node.")
 	}
 
 	if err := newNode.LoadInfo(false); err != nil {
-		logrus.Fatalf("Load new node %s info failed: %s!", newaddr, err.Error())
+		return nil, redistrib.NewError(redistrib.ErrConnection, newaddr, err, "Load new node info failed")
+	}
+	if err := newNode.AssertEmpty(); err != nil {
+		return nil, err
 	}
-	newNode.AssertEmpty()
 	self.AddNode(newNode)
 
 	// Send CLUSTER FORGET to all the nodes but the node to remove
 	logrus.Printf(">>> Send CLUSTER MEET to node %s to make it join the cluster", newNode.String())
 	if _, err := newNode.ClusterAddNode(addr); err != nil {
-		logrus.Fatalf("Add new node %s failed: %s!", newaddr, err.Error())
+		return nil, redistrib.NewError(redistrib.ErrConnection, newaddr, err, "Add new node failed")
 	}
 
 	// Additional configuration is needed if the node is added as
 	// a slave.
-	if context.Bool("slave") {
+	if master != nil {
 		self.WaitClusterJoin()
-		if master != nil {
-			logrus.Printf(">>> Configure node as replica of %s.", master.String())
-			newNode.ClusterReplicateWithNodeID(master.Name())
-		} else {
-			logrus.Fatalf("Master node is nil, can't get master info.")
+		logrus.Printf(">>> Configure node as replica of %s.", master.String())
+		if _, err := newNode.ClusterReplicateWithNodeID(master.Name()); err != nil {
+			return nil, redistrib.NewError(redistrib.ErrConnection, newaddr, err, "Configure node as replica failed")
 		}
 	}
-	logrus.Printf("[OK] New node added correctly.")
-	return nil
+	return newNode, nil
 }
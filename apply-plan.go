@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// apply-plan      host:port plan.json
+//                  --yes
+//                  --timeout <arg>
+//                  --pipeline <arg>
+//                  --journal <arg>
+//                  --resume <arg>
+var applyPlanCommand = cli.Command{
+	Name:        "apply-plan",
+	Usage:       "apply a reshard/rebalance plan to the redis cluster.",
+	ArgsUsage:   `host:port plan.json`,
+	Description: `The apply-plan command moves the slots listed in a plan written with --plan-out.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "yes",
+			Usage: `Auto agree the plan to apply.`,
+		},
+		cli.IntFlag{
+			Name:  "timeout",
+			Usage: `Timeout for apply the plan.`,
+		},
+		cli.IntFlag{
+			Name:  "pipeline",
+			Value: redistrib.MigrateDefaultPipeline,
+			Usage: `Pipeline for apply the plan.`,
+		},
+		cli.StringFlag{
+			Name:  "journal",
+			Value: "",
+			Usage: `Journal file recording the progress, a temporary file by default.`,
+		},
+		cli.StringFlag{
+			Name:  "resume",
+			Value: "",
+			Usage: `Resume an interrupted apply-plan from its journal file.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 2 && !(context.NArg() == 1 && context.String("resume") != "") {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "apply-plan")
+			return badArgument("Must provide \"host:port plan.json\" for apply-plan command!")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.ApplyPlanClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) ApplyPlanClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for apply-plan command")
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+	if err := self.CheckCluster(false); err != nil {
+		return err
+	}
+
+	if context.Int("timeout") > 0 {
+		self.SetTimeout(context.Int("timeout"))
+	}
+	opts := &redistrib.MoveOpts{
+		Dots:     true,
+		Pipeline: context.Int("pipeline"),
+		Update:   true,
+	}
+
+	if path := context.String("resume"); path != "" {
+		return resumeHint(self.ResumeJournal(path, "apply-plan", opts, nil), path)
+	}
+
+	if len(self.SlotsProblems()) > 0 {
+		return redistrib.NewError(redistrib.ErrClusterUnhealthy, "", nil, "*** Please fix your cluster problem before applying a plan.")
+	}
+
+	plan, err := redistrib.LoadPlan(context.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	journal := plan.Journal(journalPath(context, "apply-plan"), "apply-plan")
+	if err := self.ValidateJournal(journal); err != nil {
+		return err
+	}
+
+	logrus.Printf("Ready to move %d slots (about %d keys) planned by %s at %s.",
+		len(plan.Moves), plan.Keys(), plan.Command, plan.Created.Format("2006-01-02 15:04:05"))
+	if !context.Bool("yes") {
+		if err := confirm("Do you want to proceed with the plan?"); err != nil {
+			return err
+		}
+	}
+
+	if err := journal.Save(); err != nil {
+		return err
+	}
+	if journal.Path() != "" {
+		logrus.Printf(">>> Recording the apply-plan progress in %s", journal.Path())
+	}
+
+	return resumeHint(self.RunJournal(journal, opts, nil), journal.Path())
+}
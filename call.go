@@ -3,23 +3,63 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 // call            host:port command arg arg .. arg
+//                  --masters
+//                  --replicas
+//                  --nodes <arg>
+//                  --parallel <arg>
+//                  --timeout <arg>
+//                  --output <arg>
 var callCommand = cli.Command{
-	Name:        "call",
-	Usage:       "run command in redis cluster.",
-	ArgsUsage:   `host:port command arg arg .. arg`,
-	Description: `The call command for call cmd in every redis cluster node.`,
+	Name:      "call",
+	Usage:     "run command in redis cluster.",
+	ArgsUsage: `host:port command arg arg .. arg`,
+	Description: `The call command for call cmd in every redis cluster node. The integer
+   replies, like the DBSIZE ones, are summed up with their min and max. The
+   sum counts the masters only, the replicas holding copies of their keys,
+   unless no master is called.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "masters",
+			Usage: `Only call the masters.`,
+		},
+		cli.BoolFlag{
+			Name:  "replicas",
+			Usage: `Only call the replicas.`,
+		},
+		cli.StringFlag{
+			Name:  "nodes",
+			Value: "",
+			Usage: `Only call the nodes of these comma separated IDs.`,
+		},
+		cli.IntFlag{
+			Name:  "parallel",
+			Value: 1,
+			Usage: `Number of nodes called at once.`,
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: `Time to wait for the reply of each node, no limit by default.`,
+		},
+		outputFlag,
+	},
 	Action: func(context *cli.Context) error {
 		if context.NArg() < 2 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "call")
-			logrus.Fatalf("Must provide \"host:port command\" for call command!")
+			return badArgument("Must provide \"host:port command\" for call command!")
+		}
+		if err := checkOutputFormat(context); err != nil {
+			return err
 		}
 
 		rt := NewRedisTrib()
@@ -30,6 +70,26 @@ var callCommand = cli.Command{
 	},
 }
 
+// The sum, min and max of the integer replies.
+type callSummary struct {
+	Sum int64 `json:"sum"`
+	Min int64 `json:"min"`
+	Max int64 `json:"max"`
+}
+
+type callNodeOutput struct {
+	ID    string      `json:"id"`
+	Addr  string      `json:"addr"`
+	Role  string      `json:"role"`
+	Reply interface{} `json:"reply"`
+	Error string      `json:"error,omitempty"`
+}
+
+type callOutput struct {
+	Results []*callNodeOutput `json:"results"`
+	Summary *callSummary      `json:"summary,omitempty"`
+}
+
 func (self *RedisTrib) CallClusterCmd(context *cli.Context) error {
 	var addr string
 
@@ -41,15 +101,145 @@ func (self *RedisTrib) CallClusterCmd(context *cli.Context) error {
 		return err
 	}
 
+	var ids []string
+	if s := context.String("nodes"); s != "" {
+		ids = strings.Split(s, ",")
+	}
+	nodes, err := self.SelectNodes(context.Bool("masters"), context.Bool("replicas"), ids)
+	if err != nil {
+		return err
+	}
+
 	cmd := strings.ToUpper(context.Args().Get(1))
-	cmdArgs := ToInterfaceArray(context.Args()[2:])
+	cmdArgs := redistrib.ToInterfaceArray(context.Args()[2:])
+
+	logrus.Printf(">>> Calling %s %s on %d nodes", cmd, cmdArgs, len(nodes))
+	results := self.CallNodes(nodes, &redistrib.CallOpts{
+		Parallel: context.Int("parallel"),
+		Timeout:  context.Duration("timeout"),
+	}, cmd, cmdArgs...)
+	summary := summarizeReplies(results)
 
-	logrus.Printf(">>> Calling %s %s", cmd, cmdArgs)
-	_, err := self.EachRunCommandAndPrint(cmd, cmdArgs...)
+	switch format := context.String("output"); format {
+	case "table":
+		err = writeCallTable(results, summary)
+	case "json", "yaml":
+		err = writeCallOutput(format, results, summary)
+	default:
+		for _, r := range results {
+			if r.Err != nil {
+				logrus.Errorf("%s: %s", r.Node.String(), r.Err)
+				continue
+			}
+			logrus.Printf("%s: %s %s\n%s", r.Node.String(), cmd,
+				strings.Join(context.Args()[2:], " "), strings.Trim(redistrib.FormatReply(r.Reply), " \n"))
+		}
+		if summary != nil {
+			logrus.Printf(">>> Sum %d, min %d, max %d.", summary.Sum, summary.Min, summary.Max)
+		}
+	}
 	if err != nil {
-		logrus.Errorf("Command failed: %s", err)
 		return err
 	}
 
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("command failed on %d nodes", failed)
+	}
 	return nil
 }
+
+// The summary of the replies when they are all integers, nil otherwise.
+// The sum is the one of the masters when any replied, the replicas would
+// count the keys of their master again.
+func summarizeReplies(results []*redistrib.CallResult) *callSummary {
+	var summary *callSummary
+	var mastersSum, replicasSum int64
+	masters := false
+	for _, r := range results {
+		if r.Err != nil {
+			continue
+		}
+		n, ok := r.Reply.(int64)
+		if !ok {
+			return nil
+		}
+		if summary == nil {
+			summary = &callSummary{Min: n, Max: n}
+		}
+		if r.Node.HasFlag("master") {
+			mastersSum += n
+			masters = true
+		} else {
+			replicasSum += n
+		}
+		if n < summary.Min {
+			summary.Min = n
+		}
+		if n > summary.Max {
+			summary.Max = n
+		}
+	}
+	if summary != nil {
+		summary.Sum = replicasSum
+		if masters {
+			summary.Sum = mastersSum
+		}
+	}
+	return summary
+}
+
+// The reply with the bulk strings as strings, for json and yaml.
+func jsonReply(reply interface{}) interface{} {
+	switch r := reply.(type) {
+	case []byte:
+		return string(r)
+	case []interface{}:
+		elems := make([]interface{}, 0, len(r))
+		for _, e := range r {
+			elems = append(elems, jsonReply(e))
+		}
+		return elems
+	}
+	return reply
+}
+
+func writeCallOutput(format string, results []*redistrib.CallResult, summary *callSummary) error {
+	out := &callOutput{Results: []*callNodeOutput{}, Summary: summary}
+	for _, r := range results {
+		n := &callNodeOutput{
+			ID:    r.Node.Name(),
+			Addr:  r.Node.String(),
+			Role:  r.Node.Role(),
+			Reply: jsonReply(r.Reply),
+		}
+		if r.Err != nil {
+			n.Error = r.Err.Error()
+		}
+		out.Results = append(out.Results, n)
+	}
+	return writeOutput(os.Stdout, format, out)
+}
+
+func writeCallTable(results []*redistrib.CallResult, summary *callSummary) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDR\tID\tROLE\tREPLY")
+	for _, r := range results {
+		reply := strings.Replace(strings.TrimSpace(redistrib.FormatReply(r.Reply)), "\n", " ", -1)
+		if r.Err != nil {
+			reply = "ERROR: " + r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Node.String(), shortID(r.Node.Name()), r.Node.Role(), reply)
+	}
+	if summary != nil {
+		fmt.Fprintf(w, "sum\t\t\t%d\n", summary.Sum)
+		fmt.Fprintf(w, "min\t\t\t%d\n", summary.Min)
+		fmt.Fprintf(w, "max\t\t\t%d\n", summary.Max)
+	}
+	return w.Flush()
+}
@@ -3,27 +3,48 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
+	"strings"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 // check            host:port
+//                  --output <arg>
+//                  --nagios
 var checkCommand = cli.Command{
-	Name:        "check",
-	Usage:       "check the redis cluster.",
-	ArgsUsage:   `host:port`,
-	Description: `The check command check for redis cluster.`,
+	Name:      "check",
+	Usage:     "check the redis cluster.",
+	ArgsUsage: `host:port`,
+	Flags: []cli.Flag{
+		outputFlag,
+		cli.BoolFlag{
+			Name:  "nagios",
+			Usage: `Print a one line summary with perfdata, for Nagios or Icinga.`,
+		},
+	},
+	Description: `The check command check for redis cluster. It exits with 0 (OK),
+   1 (WARNING) or 2 (CRITICAL) depending on the problems found: open slots and
+   nodes disagreeing about the configuration are warnings, uncovered slots and
+   failing masters are critical. Any other error, like an unreachable node or
+   a bad argument, is UNKNOWN (3) so that it can't be taken for a finding.`,
 	Action: func(context *cli.Context) error {
 		if context.NArg() != 1 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "check")
-			logrus.Fatalf("Must provide host:port for check command!")
+			return checkUnknown(context, badArgument("Must provide host:port for check command!"))
+		}
+		if err := checkOutputFormat(context); err != nil {
+			return checkUnknown(context, err)
+		}
+		if context.Bool("nagios") && context.String("output") != "text" {
+			return checkUnknown(context, badArgument("option --nagios can't be used with --output"))
 		}
 
 		rt := NewRedisTrib()
 		if err := rt.CheckClusterCmd(context); err != nil {
-			return err
+			return checkUnknown(context, err)
 		}
 		return nil
 	},
@@ -40,6 +61,63 @@ func (self *RedisTrib) CheckClusterCmd(context *cli.Context) error {
 		return err
 	}
 
-	self.CheckCluster(false)
-	return nil
+	format := context.String("output")
+	nagios := context.Bool("nagios")
+	if err := self.CheckCluster(nagios || format != "text"); err != nil {
+		return err
+	}
+	severity := redistrib.MaxSeverity(self.Problems())
+
+	switch {
+	case nagios:
+		fmt.Println(nagiosSummary(severity, self.Report()))
+		return checkStatus(severity, "")
+	case format != "text":
+		if err := writeReport(os.Stdout, format, self.Report()); err != nil {
+			return err
+		}
+		return checkStatus(severity, "")
+	default:
+		return checkStatus(severity, fmt.Sprintf("Cluster check %s: %d problems found.",
+			severity, len(self.Problems())))
+	}
+}
+
+// The error ending check with the exit status of the severity, nil when
+// the cluster is OK.
+func checkStatus(severity redistrib.Severity, msg string) error {
+	if severity == redistrib.SeverityOK {
+		return nil
+	}
+	return &exitStatus{code: int(severity), msg: msg}
+}
+
+// The error ending check with the UNKNOWN status, instead of the exit
+// status of its kind which could be taken for a severity. With --nagios
+// the error is printed as the state of the plugin.
+func checkUnknown(context *cli.Context, err error) error {
+	if _, ok := err.(*exitStatus); ok {
+		return err
+	}
+	if context.Bool("nagios") {
+		fmt.Printf("REDIS CLUSTER %s - %s\n", redistrib.SeverityUnknown, err)
+	}
+	return &exitStatus{code: int(redistrib.SeverityUnknown), msg: err.Error()}
+}
+
+// The status line of the plugin, with the perfdata after the pipe.
+func nagiosSummary(severity redistrib.Severity, report *redistrib.ClusterReport) string {
+	summary := fmt.Sprintf("%d/%d slots covered, %d masters, %d replicas",
+		report.SlotsCovered, redistrib.ClusterHashSlots, report.Masters, report.Replicas)
+	if len(report.Problems) > 0 {
+		messages := make([]string, 0, len(report.Problems))
+		for _, p := range report.Problems {
+			messages = append(messages, p.Message)
+		}
+		summary = strings.Join(messages, " ")
+	}
+
+	return fmt.Sprintf("REDIS CLUSTER %s - %s | slots_covered=%d;;%d:;0;%d masters=%d;;;0 replicas=%d;;;0 keys=%d;;;0",
+		severity, summary, report.SlotsCovered, redistrib.ClusterHashSlots, redistrib.ClusterHashSlots,
+		report.Masters, report.Replicas, report.Keys)
 }
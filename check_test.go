@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"testing"
+
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func TestCheckStatus(t *testing.T) {
+	tests := []struct {
+		severity redistrib.Severity
+		msg      string
+		code     int
+	}{
+		{redistrib.SeverityOK, "", 0},
+		{redistrib.SeverityWarning, "Cluster check WARNING: 1 problems found.", 1},
+		{redistrib.SeverityCritical, "", 2},
+		{redistrib.SeverityUnknown, "", 3},
+	}
+	for _, tt := range tests {
+		err := checkStatus(tt.severity, tt.msg)
+		if tt.code == 0 {
+			if err != nil {
+				t.Errorf("status of %s is %v, want nil", tt.severity, err)
+			}
+			continue
+		}
+		if code := exitCode(err); code != tt.code || err.Error() != tt.msg {
+			t.Errorf("status of %s exits with %d %q, want %d %q", tt.severity, code, err, tt.code, tt.msg)
+		}
+	}
+}
+
+func TestNagiosSummary(t *testing.T) {
+	healthy := &redistrib.ClusterReport{Masters: 3, Replicas: 3, Keys: 42, SlotsCovered: 16384}
+	broken := &redistrib.ClusterReport{Masters: 2, Replicas: 1, SlotsCovered: 10923, Problems: []*redistrib.Problem{
+		{Category: redistrib.ProblemFailedMaster, Message: "Master 10.0.0.3:6379 is failing."},
+		{Category: redistrib.ProblemUncoveredSlot, Message: "Not all 16384 slots are covered by nodes."},
+	}}
+
+	tests := []struct {
+		severity redistrib.Severity
+		report   *redistrib.ClusterReport
+		want     string
+	}{
+		{redistrib.SeverityOK, healthy,
+			"REDIS CLUSTER OK - 16384/16384 slots covered, 3 masters, 3 replicas | " +
+				"slots_covered=16384;;16384:;0;16384 masters=3;;;0 replicas=3;;;0 keys=42;;;0"},
+		{redistrib.SeverityCritical, broken,
+			"REDIS CLUSTER CRITICAL - Master 10.0.0.3:6379 is failing. Not all 16384 slots are covered by nodes. | " +
+				"slots_covered=10923;;16384:;0;16384 masters=2;;;0 replicas=1;;;0 keys=0;;;0"},
+	}
+	for _, tt := range tests {
+		if got := nagiosSummary(tt.severity, tt.report); got != tt.want {
+			t.Errorf("nagiosSummary(%s) =\n%s\nwant\n%s", tt.severity, got, tt.want)
+		}
+	}
+}
+
+func TestCheckUnknown(t *testing.T) {
+	set := flag.NewFlagSet("check", flag.ContinueOnError)
+	set.Bool("nagios", false, "")
+	context := cli.NewContext(nil, set, nil)
+
+	tests := []struct {
+		err  error
+		code int
+	}{
+		// the exit status of a finding is kept
+		{checkStatus(redistrib.SeverityWarning, ""), 1},
+		// an unreachable node exits with 4 elsewhere, UNKNOWN here
+		{redistrib.NewError(redistrib.ErrConnection, "10.0.0.1:6379", errors.New("connection refused"), "Connect failed"), 3},
+		{badArgument("Must provide host:port for check command!"), 3},
+	}
+	for _, tt := range tests {
+		if code := exitCode(checkUnknown(context, tt.err)); code != tt.code {
+			t.Errorf("check of %q exits with %d, want %d", tt.err, code, tt.code)
+		}
+	}
+}
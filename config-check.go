@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+//  config-check    host:port
+//                  --param <arg>
+//                  --fix <arg>
+//                  --rewrite
+var configCheckCommand = cli.Command{
+	Name:      "config-check",
+	Usage:     "check the configuration is the same on every node.",
+	ArgsUsage: `host:port`,
+	Description: `The config-check command compares the parameters given by CONFIG GET on
+   the masters and on the replicas, and exits with 1 when they differ, with 11
+   when a node doesn't report a parameter. The default parameters are ` + strings.Join(redistrib.DefaultConfigParams, ", ") + `.
+   With --fix, the nodes already fixed get their previous values back when a
+   node fails, and the command exits with 11.`,
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "param, p",
+			Value: &cli.StringSlice{},
+			Usage: "Parameter to compare, multiple times allowed.",
+		},
+		cli.StringSliceFlag{
+			Name:  "fix",
+			Value: &cli.StringSlice{},
+			Usage: "Baseline param=value set on the nodes having another value, multiple times allowed.",
+		},
+		cli.BoolFlag{
+			Name:  "rewrite",
+			Usage: `Rewrite the configuration file of the nodes fixed.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 1 {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "config-check")
+			return badArgument("Must provide host:port for config-check command!")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.ConfigCheckClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) ConfigCheckClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for config-check command")
+	}
+
+	params := context.StringSlice("param")
+	if len(params) == 0 {
+		params = redistrib.DefaultConfigParams
+	}
+	var baseline []redistrib.ConfigParam
+	for _, e := range context.StringSlice("fix") {
+		s := strings.SplitN(e, "=", 2)
+		if len(s) != 2 || s[0] == "" {
+			return badArgument("Invalid baseline for config-check, use param=value: %s", e)
+		}
+		baseline = append(baseline, redistrib.ConfigParam{Name: s[0], Value: s[1]})
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	logrus.Printf(">>> Comparing %s on %d nodes...", strings.Join(params, ", "), len(self.Nodes()))
+	drifts, err := self.CheckConfigDrift(params)
+	for _, d := range drifts {
+		logrus.Warnf("*** %s differs on the %ss:", d.Param, d.Role)
+		for _, value := range d.Values {
+			logrus.Warnf("    %q: %s", value, strings.Join(d.Nodes[value], ", "))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(baseline) > 0 {
+		return self.fixConfig(baseline, context.Bool("rewrite"))
+	}
+	if len(drifts) == 0 {
+		logrus.Printf("[OK] All nodes agree about %s.", strings.Join(params, ", "))
+		return nil
+	}
+	return checkStatus(redistrib.SeverityWarning,
+		fmt.Sprintf("Configuration differs for %d parameters and roles.", len(drifts)))
+}
+
+// Set the baseline values on the nodes having other values. When a node
+// fails, the nodes already fixed get their previous values back.
+func (self *RedisTrib) fixConfig(baseline []redistrib.ConfigParam, rewrite bool) error {
+	var configs []*redistrib.NodeConfig
+	for _, node := range self.Nodes() {
+		config := &redistrib.NodeConfig{Node: node}
+		for _, p := range baseline {
+			// a node failing to answer is not skipped, SetNodesConfig
+			// fails on it and rolls back
+			if current, err := node.ConfigGet(p.Name); err == nil && current == p.Value {
+				continue
+			}
+			config.Params = append(config.Params, p)
+		}
+		if len(config.Params) > 0 {
+			configs = append(configs, config)
+		}
+	}
+	if len(configs) == 0 {
+		logrus.Printf("[OK] The baseline is already set on every node.")
+		return nil
+	}
+
+	logrus.Printf(">>> Setting the baseline on %d nodes...", len(configs))
+	if err := self.SetNodesConfig(configs, rewrite); err != nil {
+		return err
+	}
+	logrus.Printf(">>> Baseline set on %d nodes.", len(configs))
+	return nil
+}
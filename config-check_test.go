@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+func TestFixConfigRollback(t *testing.T) {
+	c, err := redistest.NewCluster(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Bootstrap(0); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := NewRedisTrib()
+	rt.SetDialer(c.Dialer())
+	if err := rt.LoadClusterInfoFromNode(c.Addrs()[0]); err != nil {
+		t.Fatal(err)
+	}
+	// the last node fixed fails, after the others were changed
+	nodes := rt.Nodes()
+	last := c.NodeByAddr(nodes[len(nodes)-1].String())
+	last.DisableCommand("config")
+	previous := make(map[*redistest.Node]string)
+	for _, n := range c.Nodes() {
+		previous[n] = n.Config("maxmemory")
+	}
+
+	err = rt.fixConfig([]redistrib.ConfigParam{{Name: "maxmemory", Value: "1mb"}}, false)
+	if code := exitCode(err); code != exitCodes[redistrib.ErrConfig] {
+		t.Errorf("fixConfig = %v, exit %d, want %d", err, code, exitCodes[redistrib.ErrConfig])
+	}
+	for n, value := range previous {
+		if got := n.Config("maxmemory"); got != value {
+			t.Errorf("maxmemory of %s = %q after the rollback, want %q", n.Addr(), got, value)
+		}
+	}
+
+	last.EnableCommand("config")
+	if err := rt.fixConfig([]redistrib.ConfigParam{{Name: "maxmemory", Value: "1mb"}}, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range c.Nodes() {
+		if got := n.Config("maxmemory"); got != "1mb" {
+			t.Errorf("maxmemory of %s = %q, want the baseline", n.Addr(), got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+//  config-set      host:port param value [param value...]
+//                  --rewrite
+//                  --masters-only
+//                  --replicas-only
+var configSetCommand = cli.Command{
+	Name:      "config-set",
+	Usage:     "set configuration parameters on every node.",
+	ArgsUsage: `host:port param value [param value...]`,
+	Description: `The config-set command runs CONFIG SET node by node. If a node fails, the
+   nodes already changed get their previous values back.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "rewrite",
+			Usage: `Rewrite the configuration file of every node changed.`,
+		},
+		cli.BoolFlag{
+			Name:  "masters-only",
+			Usage: `Only change the masters.`,
+		},
+		cli.BoolFlag{
+			Name:  "replicas-only",
+			Usage: `Only change the replicas.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() < 3 || context.NArg()%2 != 1 {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "config-set")
+			return badArgument("Must provide \"host:port param value [param value...]\" for config-set command!")
+		}
+		if context.Bool("masters-only") && context.Bool("replicas-only") {
+			return badArgument("Options --masters-only and --replicas-only are exclusive.")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.ConfigSetClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) ConfigSetClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for config-set command")
+	}
+
+	var params []redistrib.ConfigParam
+	args := context.Args().Tail()
+	for i := 0; i+1 < len(args); i += 2 {
+		params = append(params, redistrib.ConfigParam{Name: args[i], Value: args[i+1]})
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	var nodes []*redistrib.ClusterNode
+	for _, node := range self.Nodes() {
+		master := node.HasFlag("master")
+		if (context.Bool("masters-only") && !master) || (context.Bool("replicas-only") && master) {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+
+	logrus.Printf(">>> Reconfiguring %d nodes...", len(nodes))
+	if err := self.SetConfig(nodes, params, context.Bool("rewrite")); err != nil {
+		return err
+	}
+	logrus.Printf(">>> New configuration set on %d nodes.", len(nodes))
+	return nil
+}
@@ -7,20 +7,61 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
-// del-node        host:port node_id
+//  del-node        host:port node_id
+//                  --drain
+//                  --weight <arg>
+//                  --timeout <arg>
+//                  --pipeline <arg>
+//                  --journal <arg>
+//                  --resume <arg>
 var delNodeCommand = cli.Command{
-	Name:        "del-node",
-	Aliases:     []string{"del"},
-	Usage:       "del a redis node from existed cluster.",
-	ArgsUsage:   `host:port node_id`,
-	Description: `The del-node command delete a node from redis cluster.`,
+	Name:      "del-node",
+	Aliases:   []string{"del"},
+	Usage:     "del a redis node from existed cluster.",
+	ArgsUsage: `host:port node_id`,
+	Description: `The del-node command delete a node from redis cluster. A master
+   serving slots is refused unless --drain is given: its slots are then
+   spread over the other masters by weight, its replicas moved to them,
+   and the node deleted once empty. The drain stops at the first slot
+   failing to move, and can be resumed from its journal with --resume.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "drain",
+			Usage: `Move the slots of the node to the other masters before deleting it.`,
+		},
+		cli.StringSliceFlag{
+			Name:  "weight",
+			Value: &cli.StringSlice{},
+			Usage: "Specifies per redis node weight for --drain, multiple times allowed.",
+		},
+		cli.IntFlag{
+			Name:  "timeout",
+			Usage: `Timeout for draining the node.`,
+		},
+		cli.IntFlag{
+			Name:  "pipeline",
+			Value: redistrib.MigrateDefaultPipeline,
+			Usage: `Keys migrated at once by --drain.`,
+		},
+		cli.StringFlag{
+			Name:  "journal",
+			Value: "",
+			Usage: `Journal file recording the drain progress, a temporary file by default.`,
+		},
+		cli.StringFlag{
+			Name:  "resume",
+			Value: "",
+			Usage: `Resume an interrupted drain from its journal file, then delete the node.`,
+		},
+	},
 	Action: func(context *cli.Context) error {
 		if context.NArg() != 2 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "del-node")
-			logrus.Fatalf("Must provide \"host:port node_id\" for del-node command!")
+			return badArgument("Must provide \"host:port node_id\" for del-node command!")
 		}
 
 		rt := NewRedisTrib()
@@ -52,37 +93,67 @@ func (self *RedisTrib) DelNodeClusterCmd(context *cli.Context) error {
 	// Check if the node exists and is not empty
 	node := self.GetNodeByName(nodeid)
 	if node == nil {
-		logrus.Fatalf("No such node ID %s", nodeid)
+		return badArgument("No such node ID %s", nodeid)
 	}
 
-	if len(node.Slots()) > 0 {
-		logrus.Fatalf("Node %s is not empty! Reshard data away and try again.", node.String())
-	}
-	// Send CLUSTER FORGET to all the nodes but the node to remove
-	logrus.Printf(">>> Sending CLUSTER FORGET messages to the cluster...")
-	for _, n := range self.Nodes() {
-		if n == nil || n == node {
-			continue
+	if context.Bool("drain") || context.String("resume") != "" {
+		if err := self.drainNode(context, node); err != nil {
+			return err
 		}
+	}
+	return self.RemoveNode(node)
+}
 
-		if n.Replicate() != "" && strings.ToLower(n.Replicate()) == nodeid {
-			master := self.GetMasterWithLeastReplicas()
-			if master != nil {
-				logrus.Printf(">>> %s as replica of %s", n.String(), master.String())
-				if _, err := n.ClusterReplicateWithNodeID(master.Name()); err != nil {
-					logrus.Errorf("%s", err.Error())
-				}
-			}
-		}
+// Move all the slots of the node to the other masters, recording the
+// moves in a journal so that a failed drain can be resumed.
+func (self *RedisTrib) drainNode(context *cli.Context, node *redistrib.ClusterNode) error {
+	if context.Int("timeout") > 0 {
+		self.SetTimeout(context.Int("timeout"))
+	}
+	opts := &redistrib.MoveOpts{
+		Quiet:    true,
+		Dots:     false,
+		Update:   true,
+		Pipeline: context.Int("pipeline"),
+	}
+	progress := func(e *redistrib.JournalEntry) {
+		fmt.Print("#")
+	}
 
-		if _, err := n.ClusterForgetNodeID(nodeid); err != nil {
-			logrus.Errorf("%s", err.Error())
-		}
+	if err := self.CheckCluster(true); err != nil {
+		return err
+	}
+	if path := context.String("resume"); path != "" {
+		err := self.ResumeJournal(path, "drain", opts, progress)
+		fmt.Println()
+		return resumeHint(err, path)
 	}
-	// Finally shutdown the node
-	logrus.Printf(">>> SHUTDOWN the node.")
-	if err := node.ClusterNodeShutdown(); err != nil {
+	if len(node.Slots()) == 0 {
+		return nil
+	}
+	if len(self.SlotsProblems()) > 0 {
+		return redistrib.NewError(redistrib.ErrClusterUnhealthy, "", nil, "*** Please fix your cluster problem before draining a node.")
+	}
+
+	weights, err := self.parseWeights(context, "del-node")
+	if err != nil {
+		return err
+	}
+	logrus.Printf(">>> Draining %d slots of %s", len(node.Slots()), node.String())
+	journal, err := self.DrainPlan(node, weights)
+	if err != nil {
 		return err
 	}
-	return nil
+
+	journal.SetPath(journalPath(context, "drain"))
+	if err := journal.Save(); err != nil {
+		return err
+	}
+	if journal.Path() != "" {
+		logrus.Printf(">>> Recording the drain progress in %s", journal.Path())
+	}
+
+	err = self.RunJournal(journal, opts, progress)
+	fmt.Println()
+	return resumeHint(err, journal.Path())
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// evacuate        host:port
+//                  --host <arg>
+//                  --rehome-replicas
+//                  --state <arg>
+//                  --max-lag <arg>
+//                  --timeout <arg>
+var evacuateCommand = cli.Command{
+	Name:      "evacuate",
+	Usage:     "move every master off a host before a maintenance.",
+	ArgsUsage: `host:port`,
+	Description: `The evacuate command fails every master running on the host over to
+   one of its replicas on another host, and checks that no master is left
+   on the host. The failovers are recorded in the --state file, along with
+   the ones of the previous runs, for restore-host to move the masters back
+   after the maintenance. With
+   --rehome-replicas the masters left without a replica outside the host
+   get one from the masters having several.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "host",
+			Value: "",
+			Usage: `Address of the host to evacuate, as listed by CLUSTER NODES.`,
+		},
+		cli.BoolFlag{
+			Name:  "rehome-replicas",
+			Usage: `Give a replica outside the host to the masters without one.`,
+		},
+		cli.StringFlag{
+			Name:  "state",
+			Value: "",
+			Usage: `File recording the failovers, named after the host in the temporary directory by default.`,
+		},
+		cli.Int64Flag{
+			Name:  "max-lag",
+			Value: redistrib.FailoverDefaultMaxLag,
+			Usage: `Replication offset a replica may lag behind its master, -1 not to check it.`,
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: redistrib.FailoverDefaultTimeout,
+			Usage: `Time to wait for every node to see each failover.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 1 || context.String("host") == "" {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "evacuate")
+			return badArgument("Must provide \"--host host host:port\" for evacuate command!")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.EvacuateClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) EvacuateClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for evacuate command")
+	}
+	host := context.String("host")
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	logrus.Printf(">>> Evacuating %d masters from %s", len(self.MastersOn(host)), host)
+	results, err := self.FailoverHost(host, failoverOpts(context))
+	showFailovers(results)
+	// Record the failovers done, even when one failed.
+	evacuation := redistrib.NewEvacuation(host, results)
+	if dryRun == nil && len(evacuation.Masters) > 0 {
+		path := evacuationPath(context, host)
+		if serr := evacuation.Record(path); serr != nil {
+			logrus.Errorf("%s", serr)
+		} else {
+			logrus.Printf(">>> Failovers recorded in %s for restore-host", path)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if dryRun != nil {
+		return nil
+	}
+
+	// Check the new roles from scratch.
+	if err := self.reload(addr); err != nil {
+		return err
+	}
+	if left := self.MastersOn(host); len(left) > 0 {
+		return redistrib.NewError(redistrib.ErrFailover, left[0].String(), nil,
+			"%d masters are still on %s", len(left), host)
+	}
+	logrus.Printf("[OK] No master left on %s.", host)
+
+	if context.Bool("rehome-replicas") {
+		return self.RehomeReplicas(host)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// failover        host:port [replica_id]
+//                  --force
+//                  --takeover
+//                  --host <arg>
+//                  --max-lag <arg>
+//                  --timeout <arg>
+var failoverCommand = cli.Command{
+	Name:      "failover",
+	Usage:     "promote a replica to master of its slots.",
+	ArgsUsage: `host:port [replica_id]`,
+	Description: `The failover command promotes the replica with CLUSTER FAILOVER once
+   it is in sync with its master, and waits until every node sees the new
+   roles. With --host every master running on the host is failed over to
+   one of its replicas on another host, one after the other.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "force",
+			Usage: `Do not wait for the master, which may be down.`,
+		},
+		cli.BoolFlag{
+			Name:  "takeover",
+			Usage: `Do not wait for the agreement of the other masters.`,
+		},
+		cli.StringFlag{
+			Name:  "host",
+			Value: "",
+			Usage: `Fail over every master running on this host.`,
+		},
+		cli.Int64Flag{
+			Name:  "max-lag",
+			Value: redistrib.FailoverDefaultMaxLag,
+			Usage: `Replication offset the replica may lag behind its master, -1 not to check it.`,
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: redistrib.FailoverDefaultTimeout,
+			Usage: `Time to wait for every node to see the new roles.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.String("host") == "" && context.NArg() != 2 || context.String("host") != "" && context.NArg() != 1 {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "failover")
+			return badArgument("Must provide \"host:port replica_id\" or \"--host host host:port\" for failover command!")
+		}
+		if context.Bool("force") && context.Bool("takeover") {
+			return badArgument("--force and --takeover are exclusive")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.FailoverClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) FailoverClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for failover command")
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	opts := failoverOpts(context)
+	var results []*redistrib.FailoverResult
+	var err error
+	if host := context.String("host"); host != "" {
+		results, err = self.FailoverHost(host, opts)
+		if err == nil && len(results) == 0 {
+			logrus.Printf("*** No master on %s.", host)
+		}
+	} else {
+		replica := self.GetNodeByAbbreviatedName(context.Args().Get(1))
+		if replica == nil {
+			return badArgument("No such node ID %s", context.Args().Get(1))
+		}
+		var result *redistrib.FailoverResult
+		if result, err = self.Failover(replica, opts); err == nil {
+			results = append(results, result)
+		}
+	}
+
+	showFailovers(results)
+	return err
+}
+
+// The failover options of the --force, --takeover, --max-lag and
+// --timeout flags.
+func failoverOpts(context *cli.Context) *redistrib.FailoverOpts {
+	opts := &redistrib.FailoverOpts{
+		Mode:    redistrib.FailoverDefault,
+		MaxLag:  context.Int64("max-lag"),
+		Timeout: context.Duration("timeout"),
+	}
+	if context.Bool("force") {
+		opts.Mode = redistrib.FailoverForce
+	} else if context.Bool("takeover") {
+		opts.Mode = redistrib.FailoverTakeover
+	}
+	return opts
+}
+
+func showFailovers(results []*redistrib.FailoverResult) {
+	for _, r := range results {
+		logrus.Printf("[OK] %s is master, seen by every node after %s.",
+			r.Replica.String(), r.Took.Round(time.Millisecond))
+	}
+}
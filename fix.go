@@ -4,8 +4,8 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 // fix            host:port
@@ -18,7 +18,7 @@ var fixCommand = cli.Command{
 	Flags: []cli.Flag{
 		cli.IntFlag{
 			Name:  "timeout, t",
-			Value: MigrateDefaultTimeout,
+			Value: redistrib.MigrateDefaultTimeout,
 			Usage: `timeout for fix the redis cluster.`,
 		},
 	},
@@ -26,7 +26,7 @@ var fixCommand = cli.Command{
 		if context.NArg() != 1 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "fix")
-			logrus.Fatalf("Must provide at least \"host:port\" for fix command!")
+			return badArgument("Must provide at least \"host:port\" for fix command!")
 		}
 
 		rt := NewRedisTrib()
@@ -51,6 +51,5 @@ func (self *RedisTrib) FixClusterCmd(context *cli.Context) error {
 		return err
 	}
 
-	self.CheckCluster(false)
-	return nil
+	return self.CheckCluster(false)
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"github.com/garyburd/redigo/redis"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 // import          host:port
@@ -36,7 +37,7 @@ var importCommand = cli.Command{
 		if context.NArg() != 1 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "import")
-			logrus.Fatalf("Must provide \"host:port\" for import command!")
+			return badArgument("Must provide \"host:port\" for import command!")
 		}
 
 		rt := NewRedisTrib()
@@ -52,7 +53,7 @@ func (self *RedisTrib) ImportClusterCmd(context *cli.Context) error {
 	var source string
 
 	if source = context.String("from"); source == "" {
-		logrus.Fatalf("Option \"--from\" is required for import command!")
+		return badArgument("Option \"--from\" is required for import command!")
 	} else if addr = context.Args().Get(0); addr == "" {
 		return errors.New("please check host:port for import command")
 	}
@@ -69,22 +70,30 @@ func (self *RedisTrib) ImportClusterCmd(context *cli.Context) error {
 	}
 
 	// Check cluster, only proceed if it looks sane.
-	self.CheckCluster(false)
+	if err := self.CheckCluster(false); err != nil {
+		return err
+	}
 
 	// Connect to the source node.
 	logrus.Printf(">>> Connecting to the source Redis instance")
-	srcNode := NewClusterNode(source)
+	srcNode, err := self.NewNode(source)
+	if err != nil {
+		return err
+	}
+	if err := srcNode.Connect(); err != nil {
+		return err
+	}
 
 	if srcNode.AssertCluster() {
-		logrus.Errorf("The source node should not be a cluster node.")
+		return badArgument("The source node should not be a cluster node.")
 	}
 	dbsize, _ := srcNode.Dbsize()
 	logrus.Printf("*** Importing %d keys from DB 0", dbsize)
 
 	// Build a slot -> node map
-	slots := make(map[int]*ClusterNode)
+	slots := make(map[int]*redistrib.ClusterNode)
 	for _, node := range self.Nodes() {
-		for key, _ := range node.Slots() {
+		for key := range node.Slots() {
 			slots[key] = node
 		}
 	}
@@ -95,40 +104,44 @@ func (self *RedisTrib) ImportClusterCmd(context *cli.Context) error {
 	cursor := 0
 	for {
 		// we scan with our iter offset, starting at 0
-		if arr, err := redis.MultiBulk(srcNode.R().Do("SCAN", cursor)); err != nil {
-			logrus.Errorf("Do scan in import cmd failed: %s", err.Error())
-		} else {
-			// now we get the iter and the keys from the multi-bulk reply
-			cursor, _ = redis.Int(arr[0], nil)
-			keys, _ = redis.Strings(arr[1], nil)
-		}
-		// check if we need to stop...
-		if cursor == 0 {
-			break
+		arr, err := redis.Values(srcNode.Call("SCAN", cursor))
+		if err != nil {
+			return redistrib.NewError(redistrib.ErrConnection, srcNode.String(), err, "Do scan in import cmd failed")
 		}
+		// now we get the iter and the keys from the multi-bulk reply
+		cursor, _ = redis.Int(arr[0], nil)
+		keys, _ = redis.Strings(arr[1], nil)
 
-		var cmd []interface{}
 		for _, key := range keys {
-			slot := Key2Slot(key)
+			slot := redistrib.Key2Slot(key)
 			target := slots[int(slot)]
-			logrus.Printf("Migrating %s to %s - OK", key, target.String())
 
-			cmd = append(cmd, target.Host(), target.Port(), key, 0, MigrateDefaultTimeout)
+			if target == nil {
+				logrus.Printf("Migrating %s - slot %d is not covered", key, slot)
+				continue
+			}
 
+			// MIGRATE host port key 0 timeout [COPY] [REPLACE] [AUTH ..]
+			cmd := []interface{}{target.Host(), target.Port(), key, 0, redistrib.MigrateDefaultTimeout}
 			if useCopy {
-				cmd = append(cmd, useCopy)
+				cmd = append(cmd, "COPY")
 			}
-
 			if useReplace {
-				cmd = append(cmd, useReplace)
+				cmd = append(cmd, "REPLACE")
 			}
+			cmd = target.Credentials().MigrateArgs(cmd)
 
-			if _, err := srcNode.Call("migrate", cmd...); err != nil {
+			if _, err := srcNode.Call("MIGRATE", cmd...); err != nil {
 				logrus.Printf("Migrating %s to %s - %s", key, target.String(), err.Error())
 			} else {
 				logrus.Printf("Migrating %s to %s - OK", key, target.String())
 			}
 		}
+
+		// check if we need to stop...
+		if cursor == 0 {
+			break
+		}
 	}
 	return nil
 }
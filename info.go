@@ -3,22 +3,29 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
 
-	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 )
 
 // info            host:port
+//                  --output <arg>
 var infoCommand = cli.Command{
 	Name:        "info",
 	Usage:       "display the info of redis cluster.",
 	ArgsUsage:   `host:port`,
+	Flags: []cli.Flag{
+		outputFlag,
+	},
 	Description: `The info command get info from redis cluster.`,
 	Action: func(context *cli.Context) error {
 		if context.NArg() != 1 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "info")
-			logrus.Fatalf("Must provide host:port for info command!")
+			return badArgument("Must provide host:port for info command!")
+		}
+		if err := checkOutputFormat(context); err != nil {
+			return err
 		}
 
 		rt := NewRedisTrib()
@@ -40,6 +47,15 @@ func (self *RedisTrib) InfoClusterCmd(context *cli.Context) error {
 		return err
 	}
 
-	self.ShowClusterInfo()
-	return nil
+	format := context.String("output")
+	if format == "text" {
+		self.ShowClusterInfo()
+		return nil
+	}
+
+	// the problems are reported along the nodes
+	if err := self.CheckCluster(true); err != nil {
+		return err
+	}
+	return writeReport(os.Stdout, format, self.Report())
 }
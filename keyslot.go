@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+//  keyslot         host:port [key...]
+var keyslotCommand = cli.Command{
+	Name:      "keyslot",
+	Usage:     "show the slot and the nodes of keys.",
+	ArgsUsage: `host:port [key...]`,
+	Description: `The keyslot command prints the slot of every key, the master owning it
+   with its replicas, and whether the slot is migrating or importing. The keys
+   are read from stdin, one per line, when none is given.`,
+	Action: func(context *cli.Context) error {
+		if context.NArg() < 1 {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "keyslot")
+			return badArgument("Must provide \"host:port [key...]\" for keyslot command!")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.KeyslotClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) KeyslotClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for keyslot command")
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSLOT\tMASTER\tREPLICAS\tSTATE")
+	if keys := context.Args().Tail(); len(keys) > 0 {
+		for _, key := range keys {
+			self.writeKeyslot(w, key)
+		}
+		return w.Flush()
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 512*1024*1024)
+	for scanner.Scan() {
+		self.writeKeyslot(w, scanner.Text())
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
+
+func (self *RedisTrib) writeKeyslot(w *tabwriter.Writer, key string) {
+	slot := int(redistrib.Key2Slot(key))
+	master, replicas, state := "-", "-", "stable"
+
+	for _, node := range self.Nodes() {
+		if _, ok := node.Slots()[slot]; ok && node.HasFlag("master") {
+			master = node.String()
+			var addrs []string
+			for _, r := range node.ReplicasNodes() {
+				addrs = append(addrs, r.String())
+			}
+			if len(addrs) > 0 {
+				replicas = strings.Join(addrs, ",")
+			}
+		}
+		if id, ok := node.Migrating()[slot]; ok {
+			state = "migrating to " + self.nodeAddr(id)
+		}
+		if id, ok := node.Importing()[slot]; ok && state == "stable" {
+			state = "importing from " + self.nodeAddr(id)
+		}
+	}
+	if master == "-" {
+		state = "uncovered"
+	}
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", key, slot, master, replicas, state)
+}
+
+// The address of a node ID, or the ID if the node is not loaded.
+func (self *RedisTrib) nodeAddr(id string) string {
+	if node := self.GetNodeByName(id); node != nil {
+		return node.String()
+	}
+	return id
+}
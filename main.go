@@ -7,6 +7,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 // version will be the hash that the binary was built from
@@ -46,6 +47,68 @@ var runtimeFlags = []cli.Flag{
 		Value: "text",
 		Usage: "set the format used by logs ('text' (default), or 'json')",
 	},
+	cli.StringFlag{
+		Name:  "user",
+		Value: "",
+		Usage: "ACL username used to authenticate to every node",
+	},
+	cli.StringFlag{
+		Name:   "password, a",
+		Value:  "",
+		Usage:  "password used to authenticate to every node",
+		EnvVar: "REDISCLI_AUTH",
+	},
+	cli.StringFlag{
+		Name:  "password-file",
+		Value: "",
+		Usage: "read the password from the first line of this file",
+	},
+	cli.BoolFlag{
+		Name:  "tls",
+		Usage: "connect to every node over TLS",
+	},
+	cli.StringFlag{
+		Name:  "cacert",
+		Value: "",
+		Usage: "CA certificate file used to verify the nodes",
+	},
+	cli.StringFlag{
+		Name:  "cert",
+		Value: "",
+		Usage: "client certificate file used to authenticate to the nodes",
+	},
+	cli.StringFlag{
+		Name:  "key",
+		Value: "",
+		Usage: "private key file of the client certificate",
+	},
+	cli.StringFlag{
+		Name:  "sni",
+		Value: "",
+		Usage: "server name used for SNI and certificate verification",
+	},
+	cli.BoolFlag{
+		Name:  "insecure",
+		Usage: "skip verification of the nodes certificates",
+	},
+	cli.DurationFlag{
+		Name:  "connect-timeout",
+		Value: redistrib.DefaultConnectTimeout,
+		Usage: "time to wait for a connection to a node",
+	},
+	cli.DurationFlag{
+		Name:  "read-timeout",
+		Usage: "time to wait for a node to reply, no limit by default",
+	},
+	cli.IntFlag{
+		Name:  "workers",
+		Value: redistrib.DefaultDiscoveryWorkers,
+		Usage: "number of nodes dialed at once when loading the cluster",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print the commands changing the cluster as a script instead of sending them",
+	},
 }
 
 // runtimeBeforeSubcommands is the function to run before command-line
@@ -58,16 +121,26 @@ var runtimeCommandNotFound = commandNotFound
 // runtimeCommands is all sub-command
 var runtimeCommands = []cli.Command{
 	addNodeCommand,
+	applyPlanCommand,
 	callCommand,
 	checkCommand,
+	configCheckCommand,
+	configSetCommand,
 	createCommand,
 	delNodeCommand,
+	evacuateCommand,
+	failoverCommand,
 	fixCommand,
 	importCommand,
 	infoCommand,
+	keyslotCommand,
 	rebalanceCommand,
+	replaceNodeCommand,
 	reshardCommand,
+	restoreHostCommand,
+	rollingRestartCommand,
 	setTimeoutCommand,
+	slotStatsCommand,
 }
 
 func beforeSubcommands(context *cli.Context) error {
@@ -87,13 +160,28 @@ func beforeSubcommands(context *cli.Context) error {
 		logrus.SetOutput(f)
 	}
 
+	if err := setupAuth(context); err != nil {
+		return err
+	}
+	if err := setupTLS(context); err != nil {
+		return err
+	}
+	redistrib.DefaultDialer = &redistrib.NetDialer{
+		ConnectTimeout: context.GlobalDuration("connect-timeout"),
+		ReadTimeout:    context.GlobalDuration("read-timeout"),
+	}
+	discoveryWorkers = context.GlobalInt("workers")
+	if context.GlobalBool("dry-run") {
+		dryRun = redistrib.NewDryRun()
+	}
+
 	switch context.GlobalString("log-format") {
 	case "text":
 		// retain logrus's default.
 	case "json":
 		logrus.SetFormatter(new(logrus.JSONFormatter))
 	default:
-		logrus.Fatalf("unknown log-format %q", context.GlobalString("log-format"))
+		return badArgument("unknown log-format %q", context.GlobalString("log-format"))
 	}
 	return nil
 }
@@ -132,7 +220,11 @@ func main() {
 	app.Before = runtimeBeforeSubcommands
 	app.Commands = runtimeCommands
 
-	if err := app.Run(os.Args); err != nil {
+	err := app.Run(os.Args)
+	if dryRun != nil {
+		dryRun.WriteScript(os.Stdout)
+	}
+	if err != nil {
 		fatal(err)
 	}
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+var outputFlag = cli.StringFlag{
+	Name:  "output, o",
+	Value: "text",
+	Usage: `Output format: text, json, yaml or table.`,
+}
+
+func checkOutputFormat(context *cli.Context) error {
+	switch format := context.String("output"); format {
+	case "text", "json", "yaml", "table":
+		return nil
+	default:
+		return badArgument("unknown output format %q", format)
+	}
+}
+
+// Write v in the json or yaml format, following its json tags.
+func writeOutput(w io.Writer, format string, v interface{}) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	}
+
+	var b strings.Builder
+	writeYAML(&b, reflect.ValueOf(v), 0)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Write the report in the format, its nodes as a table followed by the
+// problems for table.
+func writeReport(w io.Writer, format string, report *redistrib.ClusterReport) error {
+	if format != "table" {
+		return writeOutput(w, format, report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDR\tID\tROLE\tMASTER\tSLOTS\tKEYS")
+	for _, n := range report.Nodes {
+		master := "-"
+		if n.Master != "" {
+			master = shortID(n.Master)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", n.Addr, shortID(n.ID), n.Role, master, n.NumSlots, n.Keys)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, p := range report.Problems {
+		if _, err := fmt.Fprintf(w, "%s: %s\n", p.Severity(), p.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The first 8 characters of a node ID, as printed in the tables.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+var yamlPlain = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+func yamlScalar(s string) string {
+	if !yamlPlain.MatchString(s) {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// A field or map entry to write.
+type yamlEntry struct {
+	key   string
+	value reflect.Value
+}
+
+func yamlEntries(v reflect.Value) []yamlEntry {
+	var entries []yamlEntry
+	if v.Kind() == reflect.Map {
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			entries = append(entries, yamlEntry{fmt.Sprint(k), v.MapIndex(k)})
+		}
+		return entries
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, omitempty := f.Name, false
+		if tag := f.Tag.Get("json"); tag != "" {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				omitempty = omitempty || opt == "omitempty"
+			}
+		}
+		fv := v.Field(i)
+		if omitempty && isEmptyValue(fv) {
+			continue
+		}
+		entries = append(entries, yamlEntry{name, fv})
+	}
+	return entries
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+	return false
+}
+
+// Whether v is written on the line of its key.
+func yamlInline(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return len(yamlEntries(v)) == 0
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	}
+	return true
+}
+
+// Write v at the indentation level, a scalar or an empty collection
+// followed by a newline, or a block collection.
+func writeYAML(b *strings.Builder, v reflect.Value, level int) {
+	indent := strings.Repeat("  ", level)
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			b.WriteString("null\n")
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		entries := yamlEntries(v)
+		if len(entries) == 0 {
+			b.WriteString("{}\n")
+			return
+		}
+		for _, e := range entries {
+			b.WriteString(indent + yamlScalar(e.key) + ":")
+			if yamlInline(e.value) {
+				b.WriteString(" ")
+				writeYAML(b, e.value, level+1)
+			} else {
+				b.WriteString("\n")
+				writeYAML(b, e.value, level+1)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			b.WriteString("[]\n")
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			item := v.Index(i)
+			b.WriteString(indent + "-")
+			if yamlInline(item) {
+				b.WriteString(" ")
+				writeYAML(b, item, level+1)
+				continue
+			}
+			// the first line of a block item follows the dash
+			var sub strings.Builder
+			writeYAML(&sub, item, level+1)
+			b.WriteString(" " + strings.TrimPrefix(sub.String(), indent+"  "))
+		}
+	case reflect.String:
+		b.WriteString(yamlScalar(v.String()) + "\n")
+	case reflect.Bool:
+		b.WriteString(strconv.FormatBool(v.Bool()) + "\n")
+	default:
+		b.WriteString(fmt.Sprint(v.Interface()) + "\n")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func testReport() *redistrib.ClusterReport {
+	return &redistrib.ClusterReport{
+		Nodes: []*redistrib.NodeReport{
+			{ID: "a1", Addr: "10.0.0.1:6379", Role: "master", Flags: []string{"myself", "master"},
+				Slots: []string{"0-8191"}, NumSlots: 8192, Replicas: []string{"b1"}, Keys: 12},
+			{ID: "b1", Addr: "10.0.0.2:6379", Role: "replica", Flags: []string{"slave"},
+				Master: "a1", Slots: []string{}, Replicas: []string{}},
+		},
+		Masters:      1,
+		Replicas:     1,
+		Keys:         12,
+		SlotsCovered: 8192,
+		Problems: []*redistrib.Problem{
+			{Category: redistrib.ProblemUncoveredSlot, Slots: []string{"8192-16383"},
+				Message: "Not all 16384 slots are covered by nodes."},
+		},
+		Unreachable: map[string]string{"10.0.0.3:6379": "dial tcp: connection refused"},
+	}
+}
+
+func TestWriteOutputJSON(t *testing.T) {
+	report := testReport()
+	var b bytes.Buffer
+	if err := writeOutput(&b, "json", report); err != nil {
+		t.Fatal(err)
+	}
+	var got redistrib.ClusterReport
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatalf("%s\n%s", err, b.String())
+	}
+	if !reflect.DeepEqual(&got, report) {
+		t.Errorf("report changed by the json round trip:\n%s", b.String())
+	}
+}
+
+// The yaml of testReport, in the order of the json tags, quoting the
+// strings a parser would take for another type.
+const wantYAML = `nodes:
+  - id: a1
+    addr: "10.0.0.1:6379"
+    role: master
+    flags:
+      - myself
+      - master
+    slots:
+      - 0-8191
+    num_slots: 8192
+    replicas:
+      - b1
+    keys: 12
+  - id: b1
+    addr: "10.0.0.2:6379"
+    role: replica
+    flags:
+      - slave
+    master: a1
+    slots: []
+    num_slots: 0
+    replicas: []
+    keys: 0
+masters: 1
+replicas: 1
+keys: 12
+slots_covered: 8192
+problems:
+  - category: uncovered-slot
+    slots:
+      - 8192-16383
+    message: "Not all 16384 slots are covered by nodes."
+unreachable:
+  "10.0.0.3:6379": "dial tcp: connection refused"
+`
+
+func TestWriteOutputYAML(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeOutput(&b, "yaml", testReport()); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != wantYAML {
+		t.Errorf("yaml output:\n%s\nwant:\n%s", b.String(), wantYAML)
+	}
+}
+
+func TestYAMLScalar(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"master", "master"},
+		{"0-8191", "0-8191"},
+		{"", `""`},
+		{"yes", `"yes"`},
+		{"NULL", `"NULL"`},
+		{"6379", `"6379"`},
+		{"1e3", `"1e3"`},
+		{"a: b", `"a: b"`},
+		{"10.0.0.1:6379", `"10.0.0.1:6379"`},
+	}
+	for _, tt := range tests {
+		if got := yamlScalar(tt.in); got != tt.want {
+			t.Errorf("yamlScalar(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteReportTable(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeReport(&b, "table", testReport()); err != nil {
+		t.Fatal(err)
+	}
+	want := `ADDR           ID  ROLE     MASTER  SLOTS  KEYS
+10.0.0.1:6379  a1  master   -       8192   12
+10.0.0.2:6379  b1  replica  a1      0      0
+CRITICAL: Not all 16384 slots are covered by nodes.
+`
+	if b.String() != want {
+		t.Errorf("table output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
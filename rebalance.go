@@ -3,28 +3,34 @@ package main
 import (
 	"errors"
 	"fmt"
-	"math"
-	"sort"
-	"strconv"
-	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 //  rebalance       host:port
 //                  --weight <arg>
 //                  --auto-weights
+//                  --by <arg>
+//                  --samples <arg>
 //                  --use-empty-masters
 //                  --timeout <arg>
 //                  --simulate
 //                  --pipeline <arg>
 //                  --threshold <arg>
+//                  --journal <arg>
+//                  --resume <arg>
+//                  --plan-out <arg>
 var rebalanceCommand = cli.Command{
 	Name:        "rebalance",
 	Usage:       "rebalance the redis cluster.",
 	ArgsUsage:   `host:port`,
-	Description: `The rebalance command for rebalance a redis cluster.`,
+	Description: `The rebalance command for rebalance a redis cluster. The masters
+   balance their slots by default, or their keys with --by keys, or
+   their memory, estimated by sampling MEMORY USAGE in every slot, with
+   --by memory. With --auto-weights the masters without a --weight weigh
+   their maxmemory, so that the bigger ones hold more data.`,
 	Flags: []cli.Flag{
 		cli.StringSliceFlag{
 			Name:  "weight",
@@ -33,7 +39,17 @@ var rebalanceCommand = cli.Command{
 		},
 		cli.BoolFlag{
 			Name:  "auto-weights",
-			Usage: `Auto-weights flag for rebalance cluster.`,
+			Usage: `Weigh the masters by their maxmemory, which must be set.`,
+		},
+		cli.StringFlag{
+			Name:  "by",
+			Value: redistrib.RebalanceBySlots,
+			Usage: `What the masters balance: slots, keys or memory.`,
+		},
+		cli.IntFlag{
+			Name:  "samples",
+			Value: redistrib.RebalanceDefaultSamples,
+			Usage: `Keys sampled per slot to estimate its memory with --by memory.`,
 		},
 		cli.BoolFlag{
 			Name:  "use-empty-masters",
@@ -45,24 +61,44 @@ var rebalanceCommand = cli.Command{
 		},
 		cli.BoolFlag{
 			Name:  "simulate",
-			Usage: `Simulate flag for rebalance cluster.`,
+			Usage: `Print the slots rebalance would move, without moving them.`,
 		},
 		cli.IntFlag{
 			Name:  "pipeline",
-			Value: MigrateDefaultPipeline,
+			Value: redistrib.MigrateDefaultPipeline,
 			Usage: `Pipeline for rebalance redis cluster.`,
 		},
 		cli.IntFlag{
 			Name:  "threshold",
-			Value: RebalanceDefaultThreshold,
+			Value: redistrib.RebalanceDefaultThreshold,
 			Usage: `Threshold for rebalance redis cluster.`,
 		},
+		cli.StringFlag{
+			Name:  "journal",
+			Value: "",
+			Usage: `Journal file recording the rebalance progress, a temporary file by default.`,
+		},
+		cli.StringFlag{
+			Name:  "resume",
+			Value: "",
+			Usage: `Resume an interrupted rebalance from its journal file.`,
+		},
+		cli.StringFlag{
+			Name:  "plan-out",
+			Value: "",
+			Usage: `Write the rebalance plan as JSON to this file instead of moving slots.`,
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if context.NArg() != 1 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "rebalance")
-			logrus.Fatalf("Must provide at least \"host:port\" for rebalance command!")
+			return badArgument("Must provide at least \"host:port\" for rebalance command!")
+		}
+		switch by := context.String("by"); by {
+		case redistrib.RebalanceBySlots, redistrib.RebalanceByKeys, redistrib.RebalanceByMemory:
+		default:
+			return badArgument("unknown rebalance mode %q", by)
 		}
 
 		rt := NewRedisTrib()
@@ -86,204 +122,88 @@ func (self *RedisTrib) RebalanceClusterCmd(context *cli.Context) error {
 		return err
 	}
 
-	// Options parsing
-	//threshold := context.Int("threshold")
-	//autoweights := context.Bool("auto-weights")
-	weights := make(map[string]int)
-	ws := context.StringSlice("weight")
-	for _, e := range ws {
-		if e != "" && strings.Contains(e, "=") {
-			s := strings.Split(e, "=")
-			node := self.GetNodeByAbbreviatedName(s[0])
-			if node == nil || !node.HasFlag("master") {
-				logrus.Fatalf("*** No such master node %s", s[0])
-			}
-
-			if w, err := strconv.Atoi(s[1]); err != nil {
-				logrus.Fatalf("Invalid weight num for rebalance: %s=%v", s[0], s[1])
-			} else {
-				weights[node.Name()] = w
-			}
-		}
+	if context.Int("timeout") > 0 {
+		self.SetTimeout(context.Int("timeout"))
+	}
+	opts := &redistrib.MoveOpts{
+		Quiet:    true,
+		Dots:     false,
+		Update:   true,
+		Pipeline: context.Int("pipeline"),
+	}
+	progress := func(e *redistrib.JournalEntry) {
+		fmt.Print("#")
 	}
-	useEmpty := context.Bool("use-empty-masters")
-
-	// Assign a weight to each node, and compute the total cluster weight.
-	totalWeight := 0
-	nodesInvolved := 0
-	for _, node := range self.Nodes() {
-		if node.HasFlag("master") {
-			if !useEmpty && len(node.Slots()) == 0 {
-				continue
-			}
-			if w, ok := weights[node.Name()]; ok {
-				node.SetWeight(w)
-			} else {
-				node.SetWeight(1)
-			}
 
-			totalWeight += node.Weight()
-			nodesInvolved += 1
+	if path := context.String("resume"); path != "" {
+		if err := self.CheckCluster(true); err != nil {
+			return err
 		}
+		err := self.ResumeJournal(path, "rebalance", opts, progress)
+		fmt.Println()
+		return resumeHint(err, path)
 	}
 
-	// Check cluster, only proceed if it looks sane.
-	self.CheckCluster(true)
-	if len(self.Errors()) > 0 {
-		logrus.Fatalf("*** Please fix your cluster problem before rebalancing.")
+	// Options parsing
+	weights, err := self.parseWeights(context, "rebalance")
+	if err != nil {
+		return err
 	}
 
-	// Calculate the slots balance for each node. It's the number of
-	// slots the node should lose (if positive) or gain (if negative)
-	// in order to be balanced.
-	threshold := context.Int("threshold")
-	thresholdReached := false
-	for _, node := range self.Nodes() {
-		if node.HasFlag("master") {
-			if node.Weight() == 0 {
-				continue
-			}
-			expected := int((float64(ClusterHashSlots) / float64(totalWeight)) * float64(node.Weight()))
-			node.SetBalance(len(node.Slots()) - expected)
-			// Compute the percentage of difference between the
-			// expected number of slots and the real one, to see
-			// if it's over the threshold specified by the user.
-			overThreshold := false
-
-			if threshold > 0 {
-				if len(node.Slots()) > 0 {
-					errPerc := math.Abs(float64(100 - (100.0*expected)/len(node.Slots())))
-					if int(errPerc) > threshold {
-						overThreshold = true
-					}
-				} else if expected > 0 {
-					overThreshold = true
-				}
-			}
-
-			if overThreshold {
-				thresholdReached = true
-			}
-		}
+	// Check cluster, only proceed if it looks sane.
+	if err := self.CheckCluster(true); err != nil {
+		return err
 	}
-	if !thresholdReached {
-		logrus.Printf("*** No rebalancing needed! All nodes are within the %d threshold.", threshold)
-		return nil
+	if len(self.SlotsProblems()) > 0 {
+		return redistrib.NewError(redistrib.ErrClusterUnhealthy, "", nil, "*** Please fix your cluster problem before rebalancing.")
 	}
 
-	// Only consider nodes we want to change
-	var sn BalanceArray
-	for _, node := range self.Nodes() {
-		if node.HasFlag("master") && node.Weight() != 0 {
-			sn = append(sn, node)
-		}
+	journal, err := self.RebalancePlan(&redistrib.RebalanceOpts{
+		Weights:         weights,
+		UseEmptyMasters: context.Bool("use-empty-masters"),
+		Threshold:       context.Int("threshold"),
+		Verbose:         context.GlobalBool("verbose"),
+		By:              context.String("by"),
+		AutoWeights:     context.Bool("auto-weights"),
+		Pipeline:        context.Int("pipeline"),
+		Samples:         context.Int("samples"),
+	})
+	if err != nil || journal == nil {
+		return err
 	}
 
-	// Because of rounding, it is possible that the balance of all nodes
-	// summed does not give 0. Make sure that nodes that have to provide
-	// slots are always matched by nodes receiving slots.
-	//total_balance = sn.map{|x| x.info[:balance]}.reduce{|a,b| a+b}
-	totalBalance := 0
-	for _, node := range sn {
-		totalBalance += node.Balance()
+	if path := context.String("plan-out"); path != "" {
+		return self.WritePlan(path, journal)
 	}
-
-	for totalBalance > 0 {
-		for _, node := range sn {
-			if node.Balance() < 0 && totalBalance > 0 {
-				b := node.Balance() - 1
-				node.SetBalance(b)
-				totalBalance -= 1
-			}
-		}
+	if context.Bool("simulate") {
+		self.showMoves(journal)
+		return nil
 	}
 
-	// TODO:
-	// Sort nodes by their slots balance.
-	sort.Sort(BalanceArray(sn))
-
-	logrus.Printf(">>> Rebalancing across %d nodes. Total weight = %d", nodesInvolved, totalWeight)
-
-	if context.GlobalBool("verbose") {
-		for _, node := range sn {
-			logrus.Printf("%s balance is %d slots", node.String(), node.Balance())
-		}
+	// Actaully move the slots.
+	journal.SetPath(journalPath(context, "rebalance"))
+	if err := journal.Save(); err != nil {
+		return err
+	}
+	if journal.Path() != "" {
+		logrus.Printf(">>> Recording the rebalance progress in %s", journal.Path())
 	}
 
-	// Now we have at the start of the 'sn' array nodes that should get
-	// slots, at the end nodes that must give slots.
-	// We take two indexes, one at the start, and one at the end,
-	// incrementing or decrementing the indexes accordingly til we
-	// find nodes that need to get/provide slots.
-	// TODO: check the logic of code
-	dstIdx := 0
-	srcIdx := len(sn) - 1
-
-	for dstIdx < srcIdx {
-		dst := sn[dstIdx]
-		src := sn[srcIdx]
-
-		var numSlots float64
-		if math.Abs(float64(dst.Balance())) < math.Abs(float64(src.Balance())) {
-			numSlots = math.Abs(float64(dst.Balance()))
-		} else {
-			numSlots = math.Abs(float64(src.Balance()))
-		}
-
-		if numSlots > 0 {
-			logrus.Printf("Moving %d slots from %s to %s", numSlots, src.String(), dst.String())
-
-			// Actaully move the slots.
-			// TODO: add move slot code.
-			srcs := ClusterArray{*src}
-			reshardTable := self.ComputeReshardTable(srcs, int(numSlots))
-			if len(reshardTable) != int(numSlots) {
-				logrus.Fatalf("*** Assertio failed: Reshard table != number of slots")
-			}
-
-			if context.Bool("simulate") {
-				logrus.Printf("%s", strings.Repeat("#", len(reshardTable)))
-			} else {
-				opts := &MoveOpts{
-					Quiet:    true,
-					Dots:     false,
-					Update:   true,
-					Pipeline: context.Int("pipeline"),
-				}
-				for _, e := range reshardTable {
-					self.MoveSlot(e, dst, opts)
-					logrus.Printf("#")
-				}
-			}
-			logrus.Printf("\n")
-		}
+	err = self.RunJournal(journal, opts, progress)
+	fmt.Println()
+	return resumeHint(err, journal.Path())
+}
 
-		// Update nodes balance.
-		dst.SetBalance(dst.Balance() + int(numSlots))
-		src.SetBalance(src.Balance() - int(numSlots))
-		if dst.Balance() == 0 {
-			dstIdx += 1
+// Print every move of the plan, for --simulate.
+func (self *RedisTrib) showMoves(journal *redistrib.Journal) {
+	for _, e := range journal.Entries {
+		source, target := e.Source, e.Target
+		if node := self.GetNodeByName(e.Source); node != nil {
+			source = node.String()
 		}
-		if src.Balance() == 0 {
-			srcIdx -= 1
+		if node := self.GetNodeByName(e.Target); node != nil {
+			target = node.String()
 		}
+		logrus.Printf("Would move slot %d from %s to %s", e.Slot, source, target)
 	}
-
-	return nil
-}
-
-///////////////////////////////////////////////////////////
-// some useful struct contains cluster node.
-type BalanceArray []*ClusterNode
-
-func (b BalanceArray) Len() int {
-	return len(b)
-}
-
-func (b BalanceArray) Swap(i, j int) {
-	b[i], b[j] = b[j], b[i]
-}
-
-func (b BalanceArray) Less(i, j int) bool {
-	return b[i].Balance() < b[j].Balance()
 }
@@ -0,0 +1,38 @@
+package redistrib
+
+// Credentials sent with AUTH by every node connection and passed to
+// MIGRATE, with the ACL form when User is set.
+type AuthConfig struct {
+	User     string
+	Password string
+}
+
+// Credentials of the node connections, empty for no authentication.
+var DefaultAuth = &AuthConfig{}
+
+// Send AUTH on a new connection, using the ACL form when a user is set.
+func (self *AuthConfig) Authenticate(c Conn) (err error) {
+	if self.Password == "" {
+		return nil
+	}
+
+	if self.User != "" {
+		_, err = c.Do("AUTH", self.User, self.Password)
+	} else {
+		_, err = c.Do("AUTH", self.Password)
+	}
+	return err
+}
+
+// Append the AUTH or AUTH2 option of MIGRATE, so that the source node
+// can authenticate against the target node.
+func (self *AuthConfig) MigrateArgs(args []interface{}) []interface{} {
+	if self.Password == "" {
+		return args
+	}
+
+	if self.User != "" {
+		return append(args, "AUTH2", self.User, self.Password)
+	}
+	return append(args, "AUTH", self.Password)
+}
@@ -0,0 +1,78 @@
+package redistrib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// Dialer authenticating its connections with its own credentials rather
+// than DefaultAuth.
+type authDialer struct {
+	redistrib.Dialer
+	auth *redistrib.AuthConfig
+}
+
+func (d *authDialer) Dial(addr string) (redistrib.Conn, error) {
+	conn, err := d.Dialer.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.auth.Authenticate(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *authDialer) Credentials() *redistrib.AuthConfig {
+	return d.auth
+}
+
+func TestMigrateWithDialerCredentials(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	keys := fill(t, c, 0, 1)
+	source, target := c.SlotOwner(0), c.SlotOwner(16383)
+	for _, n := range c.Nodes() {
+		n.RequireAuth("admin", "secret")
+	}
+
+	dialer := &authDialer{Dialer: c.Dialer(), auth: &redistrib.AuthConfig{User: "admin", Password: "secret"}}
+	move := func(rt *redistrib.RedisTrib) {
+		t.Helper()
+		if err := rt.LoadCluster(c.Addrs()[0]); err != nil {
+			t.Fatal(err)
+		}
+		journal := redistrib.NewJournal("", "reshard")
+		journal.AddMoves(rt.ComputeReshardTable(redistrib.ClusterArray{node(t, rt, source)}, 2), node(t, rt, target))
+		if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the dry run script masks the password of the dialer
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(dialer)
+	d := redistrib.NewDryRun()
+	rt.SetDryRun(d)
+	move(rt)
+	var script bytes.Buffer
+	if err := d.WriteScript(&script); err != nil {
+		t.Fatal(err)
+	}
+	if s := script.String(); strings.Contains(s, "secret") || !strings.Contains(s, "--user admin") ||
+		!strings.Contains(s, `AUTH2 admin "$REDISCLI_AUTH"`) {
+		t.Errorf("dry run script does not use the dialer credentials:\n%s", s)
+	}
+
+	rt = redistrib.NewRedisTrib()
+	rt.SetDialer(dialer)
+	move(rt)
+	for _, key := range keys {
+		if _, ok := target.Get(key); !ok {
+			t.Errorf("key %s not migrated", key)
+		}
+	}
+}
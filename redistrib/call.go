@@ -0,0 +1,119 @@
+package redistrib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options of CallNodes.
+type CallOpts struct {
+	// Nodes called at once, 1 when 0.
+	Parallel int
+	// Time to wait for the reply of a node, no limit when 0.
+	Timeout time.Duration
+}
+
+// The reply of a node to CallNodes.
+type CallResult struct {
+	Node  *ClusterNode
+	Reply interface{}
+	Err   error
+}
+
+// Select the loaded nodes by role and by ID, all of them when no filter
+// is given. The IDs may be abbreviated as long as they are unambiguous.
+func (self *RedisTrib) SelectNodes(masters, replicas bool, ids []string) ([]*ClusterNode, error) {
+	selected := make(map[*ClusterNode]bool)
+	for _, id := range ids {
+		node := self.GetNodeByAbbreviatedName(id)
+		if node == nil {
+			return nil, NewError(ErrBadArgument, "", nil, "No such node ID %s", id)
+		}
+		selected[node] = true
+	}
+
+	var nodes []*ClusterNode
+	for _, node := range self.Nodes() {
+		if len(ids) > 0 && !selected[node] {
+			continue
+		}
+		if masters != replicas && node.HasFlag("master") != masters {
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// Run the command on the nodes, opts.Parallel at once. The results are
+// in the order of the nodes.
+func (self *RedisTrib) CallNodes(nodes []*ClusterNode, opts *CallOpts, cmd string, args ...interface{}) []*CallResult {
+	results := make([]*CallResult, len(nodes))
+	parallel := opts.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				reply, err := callWithTimeout(nodes[i], opts.Timeout, cmd, args...)
+				results[i] = &CallResult{Node: nodes[i], Reply: reply, Err: err}
+			}
+		}()
+	}
+	for i := range nodes {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// Call the node, dropping its connection when the reply takes longer
+// than the timeout so that the next call dials it again.
+func callWithTimeout(node *ClusterNode, timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	if err := node.Connect(); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return node.Call(cmd, args...)
+	}
+
+	conn := node.R()
+	done := make(chan *CallResult, 1)
+	go func() {
+		reply, err := conn.Do(cmd, args...)
+		done <- &CallResult{Reply: reply, Err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.Reply, r.Err
+	case <-time.After(timeout):
+		node.Disconnect()
+		return nil, fmt.Errorf("no reply after %s", timeout)
+	}
+}
+
+// Format a reply for display, arrays one element per line.
+func FormatReply(reply interface{}) string {
+	switch r := reply.(type) {
+	case nil:
+		return "(nil)"
+	case []byte:
+		return string(r)
+	case []interface{}:
+		lines := make([]string, 0, len(r))
+		for _, e := range r {
+			lines = append(lines, FormatReply(e))
+		}
+		return strings.Join(lines, "\n")
+	}
+	return fmt.Sprint(reply)
+}
@@ -0,0 +1,58 @@
+package redistrib_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// Connection never replying to DEBUG SLEEP, until closed.
+type sleepyConn struct {
+	redistrib.Conn
+	closed chan struct{}
+}
+
+func (c *sleepyConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if strings.EqualFold(cmd, "DEBUG") {
+		<-c.closed
+		return nil, redistrib.NewError(redistrib.ErrConnection, "", nil, "use of closed connection")
+	}
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c *sleepyConn) Close() error {
+	close(c.closed)
+	return c.Conn.Close()
+}
+
+func TestCallNodesTimeout(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	dialer := c.Dialer()
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(redistrib.DialerFunc(func(addr string) (redistrib.Conn, error) {
+		conn, err := dialer.Dial(addr)
+		if err != nil {
+			return nil, err
+		}
+		return &sleepyConn{Conn: conn, closed: make(chan struct{})}, nil
+	}))
+	if err := rt.LoadCluster(c.Addrs()...); err != nil {
+		t.Fatal(err)
+	}
+	nodes := rt.Nodes()
+	opts := &redistrib.CallOpts{Parallel: len(nodes), Timeout: 50 * time.Millisecond}
+
+	for _, r := range rt.CallNodes(nodes, opts, "DEBUG", "SLEEP", "10") {
+		if r.Err == nil {
+			t.Errorf("DEBUG SLEEP on %s replied %v, want a timeout", r.Node.String(), r.Reply)
+		}
+	}
+	// the nodes are dialed again after the timeout
+	for _, r := range rt.CallNodes(nodes, opts, "PING") {
+		if r.Err != nil {
+			t.Errorf("PING on %s after a timeout: %s", r.Node.String(), r.Err)
+		}
+	}
+}
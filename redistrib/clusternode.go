@@ -0,0 +1,860 @@
+package redistrib
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/garyburd/redigo/redis"
+	"os"
+)
+
+const (
+	UnusedHashSlot = iota
+	NewHashSlot
+	AssignedHashSlot
+)
+
+///////////////////////////////////////////////////////////
+// detail info for redis node.
+type NodeInfo struct {
+	host string
+	port uint
+
+	name       string
+	addr       string
+	flags      []string
+	replicate  string
+	pingSent   int
+	pingRecv   int
+	weight     int
+	balance    int
+	linkStatus string
+	slots      map[int]int
+	migrating  map[int]string
+	importing  map[int]string
+}
+
+func (self *NodeInfo) HasFlag(flag string) bool {
+	for _, f := range self.flags {
+		if strings.Contains(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *NodeInfo) Name() string {
+	return self.name
+}
+
+func (self *NodeInfo) Host() string {
+	return self.host
+}
+
+func (self *NodeInfo) Port() uint {
+	return self.port
+}
+
+func (self *NodeInfo) Flags() []string {
+	return self.flags
+}
+
+func (self *NodeInfo) Replicate() string {
+	return self.replicate
+}
+
+func (self *NodeInfo) LinkStatus() string {
+	return self.linkStatus
+}
+
+func (self *NodeInfo) String() string {
+	return net.JoinHostPort(self.host, strconv.FormatUint(uint64(self.port), 10))
+}
+
+//////////////////////////////////////////////////////////
+// struct of redis cluster node.
+type ClusterNode struct {
+	r             Conn
+	dialer        Dialer
+	info          *NodeInfo
+	dirty         bool
+	friends       [](*NodeInfo)
+	replicasNodes [](*ClusterNode)
+	verbose       bool
+}
+
+func NewClusterNode(addr string) (node *ClusterNode, err error) {
+	var host, port string
+
+	hostport := strings.Split(addr, "@")[0]
+	parts := strings.Split(hostport, ":")
+	if len(parts) < 2 {
+		return nil, NewError(ErrBadAddress, "", nil, "Invalid IP or Port (given as %s) - use IP:Port format", addr)
+	}
+
+	if len(parts) > 2 {
+		// ipv6 in golang must like: "[fe80::1%lo0]:53", see detail in net/dial.go
+		host, port, err = net.SplitHostPort(hostport)
+		if err != nil {
+			return nil, NewError(ErrBadAddress, "", err, "Invalid address %s", addr)
+		}
+	} else {
+		host = parts[0]
+		port = parts[1]
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || host == "" {
+		return nil, NewError(ErrBadAddress, "", nil, "Invalid IP or Port (given as %s) - use IP:Port format", addr)
+	}
+	node = &ClusterNode{
+		r:      nil,
+		dialer: DefaultDialer,
+		info: &NodeInfo{
+			host:      host,
+			port:      uint(p),
+			slots:     make(map[int]int),
+			migrating: make(map[int]string),
+			importing: make(map[int]string),
+			replicate: "",
+		},
+		dirty:   false,
+		verbose: false,
+	}
+
+	if os.Getenv("ENV_MODE_VERBOSE") != "" {
+		node.verbose = true
+	}
+
+	return node, nil
+}
+
+func (self *ClusterNode) Host() string {
+	return self.info.host
+}
+
+func (self *ClusterNode) Port() uint {
+	return self.info.port
+}
+
+func (self *ClusterNode) Name() string {
+	return self.info.name
+}
+
+func (self *ClusterNode) Flags() []string {
+	return self.info.flags
+}
+
+// The role of the node, master or replica.
+func (self *ClusterNode) Role() string {
+	if self.HasFlag("master") {
+		return "master"
+	}
+	return "replica"
+}
+
+func (self *ClusterNode) HasFlag(flag string) bool {
+	for _, f := range self.info.flags {
+		if strings.Contains(f, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *ClusterNode) Replicate() string {
+	return self.info.replicate
+}
+
+func (self *ClusterNode) SetReplicate(nodeId string) {
+	self.info.replicate = nodeId
+	self.dirty = true
+}
+
+func (self *ClusterNode) Weight() int {
+	return self.info.weight
+}
+
+func (self *ClusterNode) SetWeight(w int) {
+	self.info.weight = w
+}
+
+func (self *ClusterNode) Balance() int {
+	return self.info.balance
+}
+
+func (self *ClusterNode) SetBalance(balance int) {
+	self.info.balance = balance
+}
+
+func (self *ClusterNode) Slots() map[int]int {
+	return self.info.slots
+}
+
+func (self *ClusterNode) Migrating() map[int]string {
+	return self.info.migrating
+}
+
+func (self *ClusterNode) Importing() map[int]string {
+	return self.info.importing
+}
+
+func (self *ClusterNode) R() Conn {
+	return self.r
+}
+
+// Set the dialer opening the connection to the node, before it is
+// connected.
+func (self *ClusterNode) SetDialer(dialer Dialer) {
+	self.dialer = dialer
+}
+
+// The credentials the node is connected with.
+func (self *ClusterNode) Credentials() *AuthConfig {
+	return DialerCredentials(self.dialer)
+}
+
+// Whether the node is connected over TLS.
+func (self *ClusterNode) TLSEnabled() bool {
+	return DialerTLS(self.dialer)
+}
+
+func (self *ClusterNode) Info() *NodeInfo {
+	return self.info
+}
+
+func (self *ClusterNode) IsDirty() bool {
+	return self.dirty
+}
+
+func (self *ClusterNode) Friends() []*NodeInfo {
+	return self.friends
+}
+
+func (self *ClusterNode) ReplicasNodes() []*ClusterNode {
+	return self.replicasNodes
+}
+
+func (self *ClusterNode) AddReplicasNode(node *ClusterNode) {
+	self.replicasNodes = append(self.replicasNodes, node)
+}
+
+func (self *ClusterNode) String() string {
+	return self.info.String()
+}
+
+func (self *ClusterNode) NodeString() string {
+	return self.info.String()
+}
+
+func (self *ClusterNode) Connect() (err error) {
+	if self.r != nil {
+		return nil
+	}
+
+	addr := self.String()
+	client, err := self.dialer.Dial(addr)
+	if err != nil {
+		return NewError(ErrConnection, addr, err, "Sorry, can't connect to node")
+	}
+
+	if _, err = client.Do("PING"); err != nil {
+		client.Close()
+		return NewError(ErrConnection, addr, err, "Sorry, ping node failed")
+	}
+
+	if self.verbose {
+		logrus.Printf("Connecting to node %s OK", self.String())
+	}
+
+	self.r = client
+	return nil
+}
+
+// Drop the connection to the node, the next command dials it again.
+func (self *ClusterNode) Disconnect() {
+	if self.r != nil {
+		self.r.Close()
+		self.r = nil
+	}
+}
+
+func (self *ClusterNode) Call(cmd string, args ...interface{}) (interface{}, error) {
+	err := self.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return self.r.Do(cmd, args...)
+}
+
+func (self *ClusterNode) Dbsize() (int, error) {
+	return redis.Int(self.Call("DBSIZE"))
+}
+
+// The value of a configuration parameter, an error when the node doesn't
+// know the parameter.
+func (self *ClusterNode) ConfigGet(param string) (string, error) {
+	values, err := redis.StringMap(self.Call("CONFIG", "GET", param))
+	if err != nil {
+		return "", err
+	}
+	// the names are lowercase in the reply
+	value, ok := values[strings.ToLower(param)]
+	if !ok {
+		return "", fmt.Errorf("unknown configuration parameter %s", param)
+	}
+	return value, nil
+}
+
+func (self *ClusterNode) ConfigSet(param, value string) error {
+	_, err := self.Call("CONFIG", "SET", param, value)
+	return err
+}
+
+func (self *ClusterNode) ConfigRewrite() error {
+	_, err := self.Call("CONFIG", "REWRITE")
+	return err
+}
+
+func (self *ClusterNode) ClusterAddNode(addr string) (ret string, err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" || port == "" {
+		return "", fmt.Errorf("Bad format of host:port: %s!", addr)
+	}
+	return redis.String(self.Call("CLUSTER", "meet", host, port))
+}
+
+func (self *ClusterNode) ClusterReplicateWithNodeID(nodeid string) (ret string, err error) {
+	return redis.String(self.Call("CLUSTER", "replicate", nodeid))
+}
+
+// Run CLUSTER FAILOVER on a replica, mode is "", "force" or "takeover".
+func (self *ClusterNode) ClusterFailover(mode string) (ret string, err error) {
+	if mode == "" {
+		return redis.String(self.Call("CLUSTER", "failover"))
+	}
+	return redis.String(self.Call("CLUSTER", "failover", mode))
+}
+
+func (self *ClusterNode) ClusterForgetNodeID(nodeid string) (ret string, err error) {
+	return redis.String(self.Call("CLUSTER", "forget", nodeid))
+}
+
+func (self *ClusterNode) ClusterNodeShutdown() (err error) {
+	self.r.Send("SHUTDOWN")
+	if err = self.r.Flush(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (self *ClusterNode) ClusterCountKeysInSlot(slot int) (int, error) {
+	return redis.Int(self.Call("CLUSTER", "countkeysinslot", slot))
+}
+
+// Count the keys of the slots, pipeline slots per round trip.
+func (self *ClusterNode) ClusterCountKeysInSlots(slots []int, pipeline int) (map[int]int, error) {
+	if err := self.Connect(); err != nil {
+		return nil, err
+	}
+	if pipeline < 1 {
+		pipeline = 1
+	}
+
+	counts := make(map[int]int, len(slots))
+	for len(slots) > 0 {
+		batch := slots
+		if len(batch) > pipeline {
+			batch = batch[:pipeline]
+		}
+		slots = slots[len(batch):]
+
+		for _, slot := range batch {
+			if err := self.r.Send("CLUSTER", "countkeysinslot", slot); err != nil {
+				return nil, err
+			}
+		}
+		// an empty command flushes and reads every pending reply
+		replies, err := redis.Ints(self.r.Do(""))
+		if err != nil {
+			return nil, err
+		}
+		for i, slot := range batch {
+			counts[slot] = replies[i]
+		}
+	}
+	return counts, nil
+}
+
+func (self *ClusterNode) ClusterGetKeysInSlot(slot int, pipeline int) ([]string, error) {
+	return redis.Strings(self.Call("CLUSTER", "getkeysinslot", slot, pipeline))
+}
+
+// Run CLUSTER SETSLOT <slot> <cmd> [nodeid]. The nodeid is the node the
+// subcommand refers to: the source node for "importing", the target node
+// for "migrating" and "node", and it is omitted for "stable".
+func (self *ClusterNode) ClusterSetSlot(slot int, cmd string, nodeid string) (string, error) {
+	if nodeid == "" {
+		return redis.String(self.Call("CLUSTER", "setslot", slot, cmd))
+	}
+	return redis.String(self.Call("CLUSTER", "setslot", slot, cmd, nodeid))
+}
+
+func (self *ClusterNode) AssertCluster() bool {
+	info, err := redis.String(self.Call("INFO", "cluster"))
+	if err != nil ||
+		!strings.Contains(info, "cluster_enabled:1") {
+		return false
+	}
+
+	return true
+}
+
+// The fields of an INFO section.
+func (self *ClusterNode) InfoFields(section string) (map[string]string, error) {
+	info, err := redis.String(self.Call("INFO", section))
+	if err != nil {
+		return nil, err
+	}
+	return parseInfoFields(info), nil
+}
+
+// The fields of CLUSTER INFO.
+func (self *ClusterNode) ClusterInfoFields() (map[string]string, error) {
+	info, err := redis.String(self.Call("CLUSTER", "info"))
+	if err != nil {
+		return nil, err
+	}
+	return parseInfoFields(info), nil
+}
+
+func parseInfoFields(info string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if kv := strings.SplitN(line, ":", 2); len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	return fields
+}
+
+// How the node sees the nodes of the cluster, itself included, by ID.
+// Only the address, flags, master and link status are filled in.
+func (self *ClusterNode) ClusterNodesView() (map[string]*NodeInfo, error) {
+	result, err := redis.String(self.Call("CLUSTER", "NODES"))
+	if err != nil {
+		return nil, err
+	}
+	view := make(map[string]*NodeInfo)
+	for _, line := range strings.Split(result, "\n") {
+		// name addr flags role ping_sent ping_recv epoch link_status slots
+		parts := strings.Split(strings.TrimSpace(line), " ")
+		if len(parts) <= 7 {
+			continue
+		}
+		host, port := parseNodeAddr(parts[1], self.TLSEnabled())
+		info := &NodeInfo{
+			name:       parts[0],
+			addr:       parts[1],
+			host:       host,
+			port:       port,
+			flags:      strings.Split(parts[2], ","),
+			replicate:  parts[3],
+			linkStatus: parts[7],
+		}
+		if info.replicate == "-" {
+			info.replicate = ""
+		}
+		view[info.name] = info
+	}
+	return view, nil
+}
+
+// The memory the node may use, its maxmemory. 0 when maxmemory is not
+// set: the memory of the host is shared with the other nodes it runs.
+func (self *ClusterNode) MemoryCapacity() (int64, error) {
+	fields, err := self.InfoFields("memory")
+	if err != nil {
+		return 0, err
+	}
+	if n, err := strconv.ParseInt(fields["maxmemory"], 10, 64); err == nil && n > 0 {
+		return n, nil
+	}
+	return 0, nil
+}
+
+// Estimate the memory used by the keys of the slots, from the MEMORY
+// USAGE of up to samples keys of each slot. The slots without keys are
+// not queried.
+func (self *ClusterNode) SlotsMemoryUsage(counts map[int]int, samples, pipeline int) (map[int]int64, error) {
+	if err := self.Connect(); err != nil {
+		return nil, err
+	}
+	if pipeline < 1 {
+		pipeline = 1
+	}
+
+	var slots []int
+	for slot, n := range counts {
+		if n > 0 {
+			slots = append(slots, slot)
+		}
+	}
+	sort.Ints(slots)
+
+	usage := make(map[int]int64, len(counts))
+	for len(slots) > 0 {
+		batch := slots
+		if len(batch) > pipeline {
+			batch = batch[:pipeline]
+		}
+		slots = slots[len(batch):]
+
+		for _, slot := range batch {
+			if err := self.r.Send("CLUSTER", "getkeysinslot", slot, samples); err != nil {
+				return nil, err
+			}
+		}
+		replies, err := redis.Values(self.r.Do(""))
+		if err != nil {
+			return nil, err
+		}
+
+		sampled := make([][]string, len(batch))
+		pending := 0
+		for i := range batch {
+			if sampled[i], err = redis.Strings(replies[i], nil); err != nil {
+				return nil, err
+			}
+			for _, key := range sampled[i] {
+				if err := self.r.Send("MEMORY", "usage", key); err != nil {
+					return nil, err
+				}
+				pending++
+			}
+		}
+		if pending == 0 {
+			continue
+		}
+		sizes, err := redis.Values(self.r.Do(""))
+		if err != nil {
+			return nil, err
+		}
+
+		for i, slot := range batch {
+			var total int64
+			for range sampled[i] {
+				n, _ := redis.Int64(sizes[0], nil)
+				total += n
+				sizes = sizes[1:]
+			}
+			if len(sampled[i]) > 0 {
+				usage[slot] = total / int64(len(sampled[i])) * int64(counts[slot])
+			}
+		}
+	}
+	return usage, nil
+}
+
+func (self *ClusterNode) AssertEmpty() error {
+	info, err := redis.String(self.Call("CLUSTER", "INFO"))
+	if err != nil {
+		return err
+	}
+	db0, err := redis.String(self.Call("INFO", "keyspace"))
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(info, "cluster_known_nodes:1\r\n") || strings.Contains(db0, "db0:") {
+		return NewError(ErrNodeNotEmpty, self.String(), nil,
+			"Node is not empty. Either the node already knows other nodes (check with CLUSTER NODES) or contains some key in database 0.")
+	}
+	return nil
+}
+
+func (self *ClusterNode) LoadInfo(getfriends bool) (err error) {
+	var result string
+	if result, err = redis.String(self.Call("CLUSTER", "NODES")); err != nil {
+		return err
+	}
+
+	nodes := strings.Split(result, "\n")
+	for _, val := range nodes {
+		// name addr flags role ping_sent ping_recv epoch link_status slots
+		parts := strings.Split(val, " ")
+		if len(parts) <= 7 {
+			continue
+		}
+
+		sent, _ := strconv.ParseInt(parts[4], 0, 32)
+		recv, _ := strconv.ParseInt(parts[5], 0, 32)
+		host, port := parseNodeAddr(parts[1], self.TLSEnabled())
+
+		node := &NodeInfo{
+			name:       parts[0],
+			addr:       parts[1],
+			flags:      strings.Split(parts[2], ","),
+			replicate:  parts[3],
+			pingSent:   int(sent),
+			pingRecv:   int(recv),
+			linkStatus: parts[7],
+
+			host:      host,
+			port:      port,
+			slots:     make(map[int]int),
+			migrating: make(map[int]string),
+			importing: make(map[int]string),
+		}
+
+		if parts[3] == "-" {
+			node.replicate = ""
+		}
+
+		if strings.Contains(parts[2], "myself") {
+			if self.info != nil {
+				self.info.name = node.name
+				self.info.addr = node.addr
+				self.info.flags = node.flags
+				self.info.replicate = node.replicate
+				self.info.pingSent = node.pingSent
+				self.info.pingRecv = node.pingRecv
+				self.info.linkStatus = node.linkStatus
+			} else {
+				self.info = node
+			}
+
+			for i := 8; i < len(parts); i++ {
+				// open slots are listed as [slot->-nodeid] and [slot-<-nodeid]
+				slots := strings.Trim(parts[i], "[]")
+				if strings.Contains(slots, "<") {
+					slotStr := strings.Split(slots, "-<-")
+					slotId, _ := strconv.Atoi(slotStr[0])
+					self.info.importing[slotId] = slotStr[1]
+				} else if strings.Contains(slots, ">") {
+					slotStr := strings.Split(slots, "->-")
+					slotId, _ := strconv.Atoi(slotStr[0])
+					self.info.migrating[slotId] = slotStr[1]
+				} else if strings.Contains(slots, "-") {
+					slotStr := strings.Split(slots, "-")
+					firstId, _ := strconv.Atoi(slotStr[0])
+					lastId, _ := strconv.Atoi(slotStr[1])
+					self.AddSlots(firstId, lastId)
+				} else {
+					firstId, _ := strconv.Atoi(slots)
+					self.AddSlots(firstId, firstId)
+				}
+			}
+		} else if getfriends {
+			self.friends = append(self.friends, node)
+		}
+	}
+	return nil
+}
+
+// Parse the address field of CLUSTER NODES, that is
+// ip:port@cport[,hostname][,aux=value ...]. The port reported depends on
+// whether the node was asked over TLS, so when the node also advertises
+// the tls-port or tcp-port auxiliary field, the one matching our own
+// connections, over TLS or not, is used.
+func parseNodeAddr(field string, tls bool) (host string, port uint) {
+	parts := strings.Split(field, ",")
+	hostport := strings.Split(parts[0], "@")[0]
+	if i := strings.LastIndex(hostport, ":"); i >= 0 {
+		// ipv6 addresses are not enclosed in brackets here
+		host = strings.Trim(hostport[:i], "[]")
+		p, _ := strconv.ParseUint(hostport[i+1:], 10, 0)
+		port = uint(p)
+	}
+
+	aux := "tcp-port="
+	if tls {
+		aux = "tls-port="
+	}
+	for _, field := range parts[1:] {
+		if strings.HasPrefix(field, aux) {
+			p, err := strconv.ParseUint(strings.TrimPrefix(field, aux), 10, 0)
+			if err == nil && p != 0 {
+				port = uint(p)
+			}
+		}
+	}
+	return host, port
+}
+
+func (self *ClusterNode) AddSlots(start, end int) {
+	for i := start; i <= end; i++ {
+		self.info.slots[i] = NewHashSlot
+	}
+	self.dirty = true
+}
+
+// Update the logical config after the slot was moved to another node.
+func (self *ClusterNode) DelSlot(slot int) {
+	delete(self.info.slots, slot)
+	delete(self.info.migrating, slot)
+	delete(self.info.importing, slot)
+}
+
+// Update the logical config after the slot was moved to this node.
+func (self *ClusterNode) AssignSlot(slot int) {
+	self.info.slots[slot] = AssignedHashSlot
+	delete(self.info.migrating, slot)
+	delete(self.info.importing, slot)
+}
+
+func (self *ClusterNode) FlushNodeConfig() {
+	if !self.dirty {
+		return
+	}
+
+	if self.Replicate() != "" {
+		// run replicate cmd
+		if _, err := self.ClusterReplicateWithNodeID(self.Replicate()); err != nil {
+			// If the cluster did not already joined it is possible that
+			// the slave does not know the master node yet. So on errors
+			// we return ASAP leaving the dirty flag set, to flush the
+			// config later.
+			return
+		}
+	} else {
+		var array []int
+		for s, value := range self.Slots() {
+			if value == NewHashSlot {
+				array = append(array, s)
+				self.info.slots[s] = AssignedHashSlot
+			}
+		}
+		if len(array) > 0 {
+			sort.Ints(array)
+			if _, err := self.ClusterAddSlots(array...); err != nil {
+				logrus.Errorf("Add slots to node %s failed: %s", self.String(), err)
+				return
+			}
+		}
+	}
+
+	self.dirty = false
+}
+
+func (self *ClusterNode) ClusterAddSlots(slots ...int) (ret string, err error) {
+	return redis.String(self.Call("CLUSTER", slotsArgs("addslots", slots)...))
+}
+
+func (self *ClusterNode) ClusterDelSlots(slots ...int) (ret string, err error) {
+	return redis.String(self.Call("CLUSTER", slotsArgs("delslots", slots)...))
+}
+
+func slotsArgs(subcmd string, slots []int) []interface{} {
+	args := make([]interface{}, 0, len(slots)+1)
+	args = append(args, subcmd)
+	for _, slot := range slots {
+		args = append(args, slot)
+	}
+	return args
+}
+
+func (self *ClusterNode) ClusterBumpepoch() (ret string, err error) {
+	return redis.String(self.Call("CLUSTER", "bumpepoch"))
+}
+
+func (self *ClusterNode) InfoString() (result string) {
+	var role = "M"
+
+	if !self.HasFlag("master") {
+		role = "S"
+	}
+
+	keys := make([]int, 0, len(self.Slots()))
+
+	for k := range self.Slots() {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	slotstr := MergeNumArray2NumRange(keys)
+
+	if self.Replicate() != "" && self.dirty {
+		result = fmt.Sprintf("S: %s %s", self.info.name, self.String())
+	} else {
+		// fix myself flag not the first element of []slots
+		result = fmt.Sprintf("%s: %s %s\n\t   slots:%s (%d slots) %s",
+			role, self.info.name, self.String(), slotstr, len(self.Slots()), strings.Join(self.info.flags[1:], ","))
+	}
+
+	if self.Replicate() != "" {
+		result = result + fmt.Sprintf("\n\t   replicates %s", self.Replicate())
+	} else {
+		result = result + fmt.Sprintf("\n\t   %d additional replica(s)", len(self.replicasNodes))
+	}
+
+	return result
+}
+
+func (self *ClusterNode) GetConfigSignature() string {
+	config := []string{}
+
+	result, err := redis.String(self.Call("CLUSTER", "NODES"))
+	if err != nil {
+		return ""
+	}
+
+	nodes := strings.Split(result, "\n")
+	for _, val := range nodes {
+		parts := strings.Split(val, " ")
+		if len(parts) <= 3 {
+			continue
+		}
+
+		sig := parts[0] + ":"
+
+		slots := []string{}
+		if len(parts) > 7 {
+			for i := 8; i < len(parts); i++ {
+				p := parts[i]
+				if !strings.Contains(p, "[") {
+					slots = append(slots, p)
+				}
+			}
+		}
+		if len(slots) == 0 {
+			continue
+		}
+		sort.Strings(slots)
+		sig = sig + strings.Join(slots, ",")
+
+		config = append(config, sig)
+	}
+
+	sort.Strings(config)
+	return strings.Join(config, "|")
+}
+
+///////////////////////////////////////////////////////////
+// some useful struct contains cluster node.
+type ClusterArray [](*ClusterNode)
+
+func (c ClusterArray) Len() int {
+	return len(c)
+}
+
+func (c ClusterArray) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c ClusterArray) Less(i, j int) bool {
+	return len(c[i].Slots()) < len(c[j].Slots())
+}
+
+type MovedNode struct {
+	Source *ClusterNode
+	Slot   int
+}
@@ -0,0 +1,156 @@
+package redistrib
+
+import (
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Parameters compared by CheckConfigDrift when none is given.
+var DefaultConfigParams = []string{
+	"cluster-node-timeout",
+	"cluster-require-full-coverage",
+	"maxmemory",
+	"maxmemory-policy",
+	"appendonly",
+	"save",
+}
+
+// The values of a parameter differing among the nodes of a role.
+type ConfigDrift struct {
+	Param string
+	// master or replica
+	Role string
+	// The values, the most common first.
+	Values []string
+	// Addresses of the nodes by value.
+	Nodes map[string][]string
+}
+
+// Compare the parameters across the nodes of each role of the loaded
+// cluster. The nodes failing to answer are skipped, and counted in the
+// error returned along with the drifts found among the others.
+func (self *RedisTrib) CheckConfigDrift(params []string) ([]*ConfigDrift, error) {
+	var drifts []*ConfigDrift
+	failed := 0
+	for _, param := range params {
+		for _, role := range []string{"master", "replica"} {
+			nodes := make(map[string][]string)
+			var values []string
+			for _, node := range self.Nodes() {
+				if node.Role() != role {
+					continue
+				}
+				value, err := node.ConfigGet(param)
+				if err != nil {
+					logrus.Errorf("Get %s from node %s failed: %s", param, node.String(), err)
+					failed++
+					continue
+				}
+				if nodes[value] == nil {
+					values = append(values, value)
+				}
+				nodes[value] = append(nodes[value], node.String())
+			}
+			if len(values) < 2 {
+				continue
+			}
+			sort.SliceStable(values, func(i, j int) bool {
+				return len(nodes[values[i]]) > len(nodes[values[j]])
+			})
+			drifts = append(drifts, &ConfigDrift{Param: param, Role: role, Values: values, Nodes: nodes})
+		}
+	}
+	if failed > 0 {
+		return drifts, NewError(ErrConfig, "", nil, "Failed to get %d parameter values from the nodes", failed)
+	}
+	return drifts, nil
+}
+
+// A configuration parameter and its value.
+type ConfigParam struct {
+	Name  string
+	Value string
+}
+
+// The value of a parameter before SetConfig changed it.
+type configChange struct {
+	node     *ClusterNode
+	param    string
+	previous string
+}
+
+// The parameters to set on a node.
+type NodeConfig struct {
+	Node   *ClusterNode
+	Params []ConfigParam
+}
+
+// Set the parameters node by node, rewriting their configuration file if
+// asked. When a node fails, the nodes already changed get their previous
+// values back and the error is returned.
+func (self *RedisTrib) SetConfig(nodes []*ClusterNode, params []ConfigParam, rewrite bool) error {
+	configs := make([]*NodeConfig, 0, len(nodes))
+	for _, node := range nodes {
+		configs = append(configs, &NodeConfig{Node: node, Params: params})
+	}
+	return self.SetNodesConfig(configs, rewrite)
+}
+
+// Set the parameters of each node, like SetConfig with different
+// parameters per node. The nodes without parameters are left alone.
+func (self *RedisTrib) SetNodesConfig(configs []*NodeConfig, rewrite bool) error {
+	var changes []*configChange
+
+	for _, config := range configs {
+		node := config.Node
+		if len(config.Params) == 0 {
+			continue
+		}
+		var err error
+		for _, p := range config.Params {
+			var previous string
+			if previous, err = node.ConfigGet(p.Name); err != nil {
+				break
+			}
+			if err = node.ConfigSet(p.Name, p.Value); err != nil {
+				break
+			}
+			changes = append(changes, &configChange{node: node, param: p.Name, previous: previous})
+		}
+		if err == nil && rewrite {
+			err = node.ConfigRewrite()
+		}
+		if err != nil {
+			logrus.Errorf("ERR setting the configuration of %s: %s", node.String(), err)
+			self.rollbackConfig(changes, rewrite)
+			return NewError(ErrConfig, node.String(), err, "Configuration change failed, %d changes rolled back", len(changes))
+		}
+		logrus.Printf("*** New configuration set for %s", node.String())
+	}
+	return nil
+}
+
+// Restore the previous values, the last change first.
+func (self *RedisTrib) rollbackConfig(changes []*configChange, rewrite bool) {
+	rewritten := make(map[*ClusterNode]bool)
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		logrus.Printf(">>> Restoring %s to %q on %s", c.param, c.previous, c.node.String())
+		if err := c.node.ConfigSet(c.param, c.previous); err != nil {
+			logrus.Errorf("ERR restoring %s on %s: %s", c.param, c.node.String(), err)
+		}
+	}
+	if !rewrite {
+		return
+	}
+	for _, c := range changes {
+		if rewritten[c.node] {
+			continue
+		}
+		rewritten[c.node] = true
+		if err := c.node.ConfigRewrite(); err != nil {
+			logrus.Errorf("ERR rewriting the config of %s: %s", c.node.String(), err)
+		}
+	}
+}
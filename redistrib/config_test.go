@@ -0,0 +1,76 @@
+package redistrib_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func TestConfigGet(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	rt := load(t, c)
+	n := node(t, rt, c.Nodes()[0])
+
+	if value, err := n.ConfigGet("MAXMEMORY-POLICY"); err != nil || value != c.Nodes()[0].Config("maxmemory-policy") {
+		t.Errorf("ConfigGet(MAXMEMORY-POLICY) = %q, %v", value, err)
+	}
+	if value, err := n.ConfigGet("no-such-param"); err == nil {
+		t.Errorf("ConfigGet(no-such-param) = %q, want an error", value)
+	}
+}
+
+func TestCheckConfigDriftUnknownParam(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	rt := load(t, c)
+
+	drifts, err := rt.CheckConfigDrift([]string{"no-such-param"})
+	if redistrib.KindOf(err) != redistrib.ErrConfig {
+		t.Errorf("CheckConfigDrift of an unknown parameter: %v, want a config failure", err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("drifts = %v, want none", drifts)
+	}
+}
+
+func TestSetConfigRollback(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	rt := load(t, c)
+	first := c.Nodes()[0]
+	previous := first.Config("maxmemory")
+
+	params := []redistrib.ConfigParam{{Name: "MAXMEMORY", Value: "1mb"}, {Name: "no-such-param", Value: "x"}}
+	err := rt.SetConfig([]*redistrib.ClusterNode{node(t, rt, first)}, params, false)
+	if redistrib.KindOf(err) != redistrib.ErrConfig {
+		t.Fatalf("SetConfig = %v, want a config failure", err)
+	}
+	if got := first.Config("maxmemory"); got != previous {
+		t.Errorf("maxmemory = %q after the rollback, want %q", got, previous)
+	}
+}
+
+func TestSetNodesConfigRollback(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	rt := load(t, c)
+	first, second := c.Nodes()[0], c.Nodes()[1]
+	previous := first.Config("maxmemory")
+	second.DisableCommand("config")
+
+	configs := []*redistrib.NodeConfig{
+		{Node: node(t, rt, first), Params: []redistrib.ConfigParam{{Name: "maxmemory", Value: "1mb"}}},
+		{Node: node(t, rt, c.Nodes()[2])},
+		{Node: node(t, rt, second), Params: []redistrib.ConfigParam{{Name: "maxmemory-policy", Value: "allkeys-lru"}}},
+	}
+	err := rt.SetNodesConfig(configs, false)
+	if redistrib.KindOf(err) != redistrib.ErrConfig {
+		t.Fatalf("SetNodesConfig = %v, want a config failure", err)
+	}
+	if got := first.Config("maxmemory"); got != previous {
+		t.Errorf("maxmemory = %q after the rollback, want %q", got, previous)
+	}
+	for _, cmd := range c.Nodes()[2].Commands() {
+		if len(cmd) > 1 && cmd[0] == "config" && strings.EqualFold(cmd[1], "SET") {
+			t.Errorf("node without parameters reconfigured: %v", cmd)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package redistrib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Conn is a connection to a node. A redigo redis.Conn satisfies it, so
+// does any wrapper recording, rewriting or failing the commands.
+type Conn interface {
+	Do(cmd string, args ...interface{}) (interface{}, error)
+	Send(cmd string, args ...interface{}) error
+	Flush() error
+	Close() error
+}
+
+// Dialer opens the connections to the nodes, given as host:port. The
+// connection returned is ready to use, authenticated if needed.
+type Dialer interface {
+	Dial(addr string) (Conn, error)
+}
+
+// A Dialer telling the credentials its connections authenticate with.
+// MIGRATE passes them on to the target node, DefaultAuth is passed for
+// the other dialers.
+type CredentialsDialer interface {
+	Dialer
+	Credentials() *AuthConfig
+}
+
+// The credentials of the connections opened by the dialer.
+func DialerCredentials(dialer Dialer) *AuthConfig {
+	if d, ok := dialer.(CredentialsDialer); ok {
+		return d.Credentials()
+	}
+	return DefaultAuth
+}
+
+// A Dialer telling whether its connections use TLS. The nodes advertise
+// a port for each, the one matching the dialer is used, the one of
+// DefaultTLS for the other dialers.
+type TLSDialer interface {
+	Dialer
+	TLSEnabled() bool
+}
+
+// Whether the connections opened by the dialer use TLS.
+func DialerTLS(dialer Dialer) bool {
+	if d, ok := dialer.(TLSDialer); ok {
+		return d.TLSEnabled()
+	}
+	return DefaultTLS.Enabled
+}
+
+// DialerFunc adapts a function to the Dialer interface.
+type DialerFunc func(addr string) (Conn, error)
+
+func (f DialerFunc) Dial(addr string) (Conn, error) {
+	return f(addr)
+}
+
+const DefaultConnectTimeout = 60 * time.Second
+
+// NetDialer dials the nodes over TCP, with TLS when enabled, and sends
+// AUTH on the new connections.
+type NetDialer struct {
+	ConnectTimeout time.Duration
+	// Time to wait for a reply, no limit when 0.
+	ReadTimeout time.Duration
+	// DefaultAuth and DefaultTLS when nil.
+	Auth *AuthConfig
+	TLS  *TLSOptions
+}
+
+func (self *NetDialer) Credentials() *AuthConfig {
+	if self.Auth == nil {
+		return DefaultAuth
+	}
+	return self.Auth
+}
+
+func (self *NetDialer) tlsOptions() *TLSOptions {
+	if self.TLS == nil {
+		return DefaultTLS
+	}
+	return self.TLS
+}
+
+func (self *NetDialer) TLSEnabled() bool {
+	return self.tlsOptions().Enabled
+}
+
+func (self *NetDialer) Dial(addr string) (Conn, error) {
+	auth, tlsOpts := self.Credentials(), self.tlsOptions()
+	timeout := self.ConnectTimeout
+	if timeout == 0 {
+		timeout = DefaultConnectTimeout
+	}
+
+	tlsDialOptions, err := tlsOpts.DialOptions()
+	if err != nil {
+		return nil, err
+	}
+	options := append([]redis.DialOption{
+		redis.DialConnectTimeout(timeout),
+		redis.DialReadTimeout(self.ReadTimeout),
+	}, tlsDialOptions...)
+	c, err := redis.Dial("tcp", addr, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = auth.Authenticate(c); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("authenticate failed: %s", err)
+	}
+	return c, nil
+}
+
+// Dialer of the nodes created without an explicit one.
+var DefaultDialer Dialer = &NetDialer{}
@@ -0,0 +1,37 @@
+// Package redistrib manages a Redis Cluster: it loads the topology from
+// any of its nodes, inspects nodes and slots, plans reshard and rebalance
+// operations and moves slots between masters with MIGRATE.
+//
+// The redis-trib command line tool is a thin layer over this package,
+// which can be embedded in other programs as well:
+//
+//	rt := redistrib.NewRedisTrib()
+//	if err := rt.LoadCluster("10.0.0.1:6379", "10.0.0.2:6379"); err != nil {
+//		return err
+//	}
+//	for _, node := range rt.Masters() {
+//		fmt.Println(node.String(), len(node.Slots()))
+//	}
+//
+//	journal, err := rt.RebalancePlan(&redistrib.RebalanceOpts{Threshold: 2})
+//	if err == nil && journal != nil {
+//		err = rt.RunJournal(journal, &redistrib.MoveOpts{Update: true}, nil)
+//	}
+//
+// The operations return an *Error on failure, KindOf tells its kind.
+//
+// The nodes are connected by a Dialer, DefaultDialer unless SetDialer
+// sets another one. The default NetDialer uses the credentials of
+// DefaultAuth and the settings of DefaultTLS, MIGRATE passes the ones of
+// the dialer of the target node on, and the nodes are loaded with the
+// ports matching the TLS setting of the dialer. A Dialer can wrap the Conn
+// of another one to record the commands or inject faults:
+//
+//	rt.SetDialer(redistrib.DialerFunc(func(addr string) (redistrib.Conn, error) {
+//		conn, err := redistrib.DefaultDialer.Dial(addr)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return &recorder{Conn: conn, addr: addr}, nil
+//	}))
+package redistrib
@@ -0,0 +1,135 @@
+package redistrib
+
+import (
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Plan the moves of all the slots of the node to the other masters
+// serving slots, and to the empty masters given a weight. Every slot goes
+// to the master furthest below its share of the cluster according to the
+// weights, 1 by default, so the masters end up balanced as far as the
+// slots drained allow. The logical config of the nodes is updated with
+// the planned moves.
+func (self *RedisTrib) DrainPlan(node *ClusterNode, weights map[string]int) (*Journal, error) {
+	var targets []*ClusterNode
+	totalWeight := 0
+	for _, m := range self.Masters() {
+		if m == node || m.HasFlag("fail") {
+			continue
+		}
+		w, ok := weights[m.Name()]
+		if !ok {
+			if len(m.Slots()) == 0 {
+				continue
+			}
+			w = 1
+		}
+		if w <= 0 {
+			continue
+		}
+		m.SetWeight(w)
+		targets = append(targets, m)
+		totalWeight += w
+	}
+	if len(targets) == 0 {
+		return nil, NewError(ErrClusterUnhealthy, node.String(), nil, "No master to drain the node to")
+	}
+
+	// The number of slots each target gets.
+	counts := make(map[*ClusterNode]int)
+	shares := make(map[*ClusterNode]int)
+	for _, t := range targets {
+		counts[t] = len(t.Slots())
+	}
+	for i := 0; i < len(node.Slots()); i++ {
+		var best *ClusterNode
+		var bestMissing float64
+		for _, t := range targets {
+			missing := float64(ClusterHashSlots)*float64(t.Weight())/float64(totalWeight) - float64(counts[t])
+			if best == nil || missing > bestMissing {
+				best, bestMissing = t, missing
+			}
+		}
+		counts[best]++
+		shares[best]++
+	}
+
+	journal := NewJournal("", "drain")
+	for _, t := range targets {
+		if shares[t] == 0 {
+			continue
+		}
+		logrus.Printf("Moving %d slots from %s to %s", shares[t], node.String(), t.String())
+		table := self.ComputeReshardTable(ClusterArray{node}, shares[t])
+		if len(table) != shares[t] {
+			return nil, NewError(ErrUnknown, "", nil, "*** Assertion failed: Reshard table != number of slots")
+		}
+		journal.PlanMoves(table, t)
+	}
+	return journal, nil
+}
+
+// Make the other nodes forget the node, moving its replicas to the
+// masters with the fewest replicas, then shut it down. The node must not
+// serve slots.
+func (self *RedisTrib) RemoveNode(node *ClusterNode) error {
+	nodeid := node.Name()
+	if len(node.Slots()) > 0 {
+		return NewError(ErrNodeNotEmpty, node.String(), nil, "Node is not empty! Reshard data away and try again.")
+	}
+	// Send CLUSTER FORGET to all the nodes but the node to remove
+	logrus.Printf(">>> Sending CLUSTER FORGET messages to the cluster...")
+	for _, n := range self.Nodes() {
+		if n == nil || n == node {
+			continue
+		}
+
+		if n.Replicate() != "" && strings.ToLower(n.Replicate()) == nodeid {
+			master := self.replicaHome(node)
+			if master != nil {
+				logrus.Printf(">>> %s as replica of %s", n.String(), master.String())
+				if _, err := n.ClusterReplicateWithNodeID(master.Name()); err != nil {
+					logrus.Errorf("%s", err.Error())
+				} else {
+					master.AddReplicasNode(n)
+				}
+			}
+		}
+
+		if _, err := n.ClusterForgetNodeID(nodeid); err != nil {
+			logrus.Errorf("%s", err.Error())
+		}
+	}
+	// Finally shutdown the node
+	logrus.Printf(">>> SHUTDOWN the node.")
+	if err := node.ClusterNodeShutdown(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// The master with the fewest replicas other than the node being removed,
+// preferring the masters serving slots.
+func (self *RedisTrib) replicaHome(node *ClusterNode) *ClusterNode {
+	var home *ClusterNode
+	for _, m := range self.Masters() {
+		if m == node || m.HasFlag("fail") {
+			continue
+		}
+		if home == nil {
+			home = m
+			continue
+		}
+		serving, homeServing := len(m.Slots()) > 0, len(home.Slots()) > 0
+		if serving != homeServing {
+			if serving {
+				home = m
+			}
+		} else if len(m.ReplicasNodes()) < len(home.ReplicasNodes()) {
+			home = m
+		}
+	}
+	return home
+}
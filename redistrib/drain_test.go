@@ -0,0 +1,158 @@
+package redistrib_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+// Give all the slots of the master but the first keep ones to the other
+// masters in turn, so that a drain has few slots to move.
+func shrink(t *testing.T, c *redistest.Cluster, master *redistest.Node, keep int) {
+	t.Helper()
+	var others []*redistest.Node
+	for _, n := range c.Nodes() {
+		if n != master && n.Master() == nil {
+			others = append(others, n)
+		}
+	}
+	for i, slot := range master.Slots()[keep:] {
+		owner := others[i%len(others)].ID()
+		for _, n := range append(others, master) {
+			if _, err := n.Do("CLUSTER", "SETSLOT", strconv.Itoa(slot), "NODE", owner); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// Check that no slot is left on the drained master, its keys moved, and
+// remove it.
+func removeDrained(t *testing.T, c *redistest.Cluster, drained *redistest.Node, keys []string) {
+	t.Helper()
+	for slot := 0; slot < redistrib.ClusterHashSlots; slot++ {
+		if owner := c.SlotOwner(slot); owner == nil || owner == drained {
+			t.Fatalf("slot %d owned by %v after the drain", slot, owner)
+		}
+	}
+	for _, key := range keys {
+		if _, ok := c.SlotOwner(int(redistrib.Key2Slot(key))).Get(key); !ok {
+			t.Errorf("key %s lost by the drain", key)
+		}
+	}
+
+	rt := load(t, c)
+	if err := rt.RemoveNode(node(t, rt, drained)); err != nil {
+		t.Fatal(err)
+	}
+	if !drained.IsDown() {
+		t.Errorf("drained master %s not shut down", drained.Addr())
+	}
+	for _, n := range c.Nodes() {
+		if n.IsDown() {
+			continue
+		}
+		if n.Master() == drained {
+			t.Errorf("%s still replicates the removed master", n.Addr())
+		}
+		nodes, err := n.Do("CLUSTER", "NODES")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(fmt.Sprint(nodes), drained.ID()) {
+			t.Errorf("%s did not forget the removed master", n.Addr())
+		}
+	}
+}
+
+func TestDrainNode(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	drained := c.SlotOwner(0)
+	shrink(t, c, drained, 20)
+	keys := fill(t, c, drained.Slots()...)
+
+	rt := load(t, c)
+	src := node(t, rt, drained)
+	count := len(src.Slots())
+	journal, err := rt.DrainPlan(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.Entries) != count {
+		t.Fatalf("drain planned %d moves, want %d", len(journal.Entries), count)
+	}
+	path := filepath.Join(t.TempDir(), "drain.journal")
+	journal.SetPath(path)
+	if err := journal.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal %s left after the drain: %v", path, err)
+	}
+
+	// the other masters share the slots evenly
+	for _, n := range c.Nodes() {
+		if n != drained && n.Master() == nil {
+			if got := len(n.Slots()); got < 8191 || got > 8193 {
+				t.Errorf("%s has %d slots after the drain, want 8192", n.Addr(), got)
+			}
+		}
+	}
+	removeDrained(t, c, drained, keys)
+}
+
+func TestDrainResume(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	drained := c.SlotOwner(0)
+	shrink(t, c, drained, 20)
+	keys := fill(t, c, drained.Slots()...)
+
+	rt := load(t, c)
+	journal, err := rt.DrainPlan(node(t, rt, drained), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "drain.journal")
+	journal.SetPath(path)
+	if err := journal.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// MIGRATE fails after 5 slots.
+	done := 0
+	err = rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, func(e *redistrib.JournalEntry) {
+		if done++; done == 5 {
+			drained.DisableCommand("migrate")
+		}
+	})
+	if redistrib.KindOf(err) != redistrib.ErrMigrate {
+		t.Fatalf("interrupted drain returned %v, want a migrate failure", err)
+	}
+	if len(drained.Slots()) == 0 {
+		t.Fatal("interrupted drain moved every slot")
+	}
+
+	// the node can't be removed halfway
+	rt = load(t, c)
+	if err := rt.RemoveNode(node(t, rt, drained)); redistrib.KindOf(err) != redistrib.ErrNodeNotEmpty {
+		t.Errorf("removal of a half drained master returned %v, want node not empty", err)
+	}
+
+	drained.EnableCommand("migrate")
+	if err := rt.ResumeJournal(path, "drain", &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal %s left after the resume: %v", path, err)
+	}
+	removeDrained(t, c, drained, keys)
+}
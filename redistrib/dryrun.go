@@ -0,0 +1,318 @@
+package redistrib
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Commands and CLUSTER/CONFIG subcommands that don't change the cluster,
+// the dry run sends them. Any other command is captured.
+var readOnlyCommands = map[string]bool{
+	"auth":    true,
+	"dbsize":  true,
+	"echo":    true,
+	"exists":  true,
+	"get":     true,
+	"info":    true,
+	"keys":    true,
+	"memory":  true,
+	"ping":    true,
+	"scan":    true,
+	"select":  true,
+	"ttl":     true,
+	"type":    true,
+	"command": true,
+
+	"cluster countkeysinslot":       true,
+	"cluster count-failure-reports": true,
+	"cluster getkeysinslot":         true,
+	"cluster info":                  true,
+	"cluster keyslot":               true,
+	"cluster myid":                  true,
+	"cluster nodes":                 true,
+	"cluster replicas":              true,
+	"cluster slaves":                true,
+	"cluster slots":                 true,
+	"cluster shards":                true,
+	"config get":                    true,
+}
+
+func isReadOnly(cmd string, args []interface{}) bool {
+	if cmd == "" {
+		// flushes the pipeline and reads its replies
+		return true
+	}
+	cmd = strings.ToLower(cmd)
+	if (cmd == "cluster" || cmd == "config") && len(args) > 0 {
+		cmd = cmd + " " + strings.ToLower(fmt.Sprint(args[0]))
+	}
+	return readOnlyCommands[cmd]
+}
+
+// A command captured by a dry run.
+type DryRunCommand struct {
+	// Address of the node, as host:port.
+	Addr string
+	Args []string
+}
+
+// DryRun captures the commands changing the cluster instead of sending
+// them, and lets the read-only ones through. The keys it pretends to
+// MIGRATE are hidden from the GETKEYSINSLOT and COUNTKEYSINSLOT replies
+// of their node, so that the slot migrations finish.
+type DryRun struct {
+	mu       sync.Mutex
+	commands []*DryRunCommand
+	// keys migrated away, by node address
+	moved map[string]map[string]bool
+	// a CLUSTER MEET was captured
+	met bool
+	// credentials and transport of the wrapped dialer
+	auth *AuthConfig
+	tls  bool
+}
+
+func NewDryRun() *DryRun {
+	return &DryRun{moved: make(map[string]map[string]bool)}
+}
+
+// Capture the commands sent by the cluster manager, its nodes are dialed
+// by a dry run wrapper of its dialer from now on.
+func (self *RedisTrib) SetDryRun(d *DryRun) {
+	self.dryRun = d
+	self.dialer = d.Dialer(self.dialer)
+}
+
+func (self *RedisTrib) DryRun() *DryRun {
+	return self.dryRun
+}
+
+// Wrap the connections of the dialer.
+func (self *DryRun) Dialer(dialer Dialer) Dialer {
+	self.auth = DialerCredentials(dialer)
+	self.tls = DialerTLS(dialer)
+	return &dryRunDialer{dialer: dialer, d: self}
+}
+
+type dryRunDialer struct {
+	dialer Dialer
+	d      *DryRun
+}
+
+func (self *dryRunDialer) Dial(addr string) (Conn, error) {
+	conn, err := self.dialer.Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &dryRunConn{Conn: conn, addr: addr, d: self.d}, nil
+}
+
+func (self *dryRunDialer) Credentials() *AuthConfig {
+	return DialerCredentials(self.dialer)
+}
+
+func (self *dryRunDialer) TLSEnabled() bool {
+	return DialerTLS(self.dialer)
+}
+
+// The commands captured so far, in order.
+func (self *DryRun) Commands() []*DryRunCommand {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return append([]*DryRunCommand(nil), self.commands...)
+}
+
+// Write the captured commands as a shell script of redis-cli calls. The
+// passwords are taken from the REDISCLI_AUTH environment variable.
+func (self *DryRun) WriteScript(w io.Writer) error {
+	commands := self.Commands()
+	auth := self.auth
+	if auth == nil {
+		auth = DefaultAuth
+	}
+	if _, err := fmt.Fprintf(w, "# redis-trib dry run: %d commands not sent\n", len(commands)); err != nil {
+		return err
+	}
+
+	cli := "redis-cli"
+	if auth.User != "" {
+		cli += " --user " + shellQuote(auth.User)
+	}
+	if self.tls {
+		cli += " --tls"
+	}
+
+	for _, c := range commands {
+		host, port, _ := net.SplitHostPort(c.Addr)
+		args := make([]string, 0, len(c.Args))
+		for i, arg := range c.Args {
+			if auth.Password != "" && arg == auth.Password &&
+				((i >= 1 && strings.EqualFold(c.Args[i-1], "AUTH")) || (i >= 2 && strings.EqualFold(c.Args[i-2], "AUTH2"))) {
+				args = append(args, `"$REDISCLI_AUTH"`)
+				continue
+			}
+			args = append(args, shellQuote(arg))
+		}
+		if _, err := fmt.Fprintf(w, "%s -h %s -p %s %s\n", cli, host, port, strings.Join(args, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.:,/@=+", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func (self *DryRun) capture(addr string, cmd string, args []interface{}) {
+	c := &DryRunCommand{Addr: addr, Args: []string{strings.ToUpper(cmd)}}
+	for _, arg := range args {
+		c.Args = append(c.Args, fmt.Sprint(arg))
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.commands = append(self.commands, c)
+
+	if strings.EqualFold(cmd, "CLUSTER") && len(c.Args) > 1 && strings.EqualFold(c.Args[1], "MEET") {
+		self.met = true
+	}
+
+	if strings.EqualFold(cmd, "MIGRATE") && len(c.Args) > 5 {
+		keys, keep := migrateKeys(c.Args[1:])
+		if keep {
+			return
+		}
+		if self.moved[addr] == nil {
+			self.moved[addr] = make(map[string]bool)
+		}
+		for _, key := range keys {
+			self.moved[addr][key] = true
+		}
+	}
+}
+
+// Keys of MIGRATE host port key db timeout [COPY] [REPLACE] [AUTH ..]
+// [AUTH2 ..] [KEYS ..], and whether COPY keeps them on the source.
+func migrateKeys(args []string) (keys []string, keep bool) {
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "COPY":
+			keep = true
+		case "AUTH":
+			i++
+		case "AUTH2":
+			i += 2
+		case "KEYS":
+			return args[i+1:], keep
+		}
+	}
+	return []string{args[2]}, keep
+}
+
+// Keys of the slot migrated away from the node.
+func (self *DryRun) movedKeys(addr string, slot int) map[string]bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	keys := make(map[string]bool)
+	for key := range self.moved[addr] {
+		if int(Key2Slot(key)) == slot {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+type dryRunConn struct {
+	Conn
+	addr string
+	d    *DryRun
+}
+
+func (self *dryRunConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	if isReplicate(cmd, args) && !self.knows(fmt.Sprint(args[1])) {
+		// Fail like the node would, the callers retry once the nodes met.
+		return nil, redis.Error(fmt.Sprintf("ERR Unknown node %s", args[1]))
+	}
+	if !isReadOnly(cmd, args) {
+		self.d.capture(self.addr, cmd, args)
+		return "OK", nil
+	}
+	if !strings.EqualFold(cmd, "CLUSTER") || len(args) < 2 {
+		return self.Conn.Do(cmd, args...)
+	}
+
+	sub := strings.ToLower(fmt.Sprint(args[0]))
+	slot, err := strconv.Atoi(fmt.Sprint(args[1]))
+	if err != nil || (sub != "getkeysinslot" && sub != "countkeysinslot") {
+		return self.Conn.Do(cmd, args...)
+	}
+	moved := self.d.movedKeys(self.addr, slot)
+	if len(moved) == 0 {
+		return self.Conn.Do(cmd, args...)
+	}
+
+	if sub == "countkeysinslot" {
+		n, err := redis.Int(self.Conn.Do(cmd, args...))
+		if err != nil {
+			return nil, err
+		}
+		return int64(n - len(moved)), nil
+	}
+
+	if len(args) < 3 {
+		return self.Conn.Do(cmd, args...)
+	}
+	count, err := strconv.Atoi(fmt.Sprint(args[2]))
+	if err != nil {
+		return self.Conn.Do(cmd, args...)
+	}
+	keys, err := redis.Strings(self.Conn.Do(cmd, args[0], args[1], count+len(moved)))
+	if err != nil {
+		return nil, err
+	}
+	reply := []interface{}{}
+	for _, key := range keys {
+		if !moved[key] && len(reply) < count {
+			reply = append(reply, []byte(key))
+		}
+	}
+	return reply, nil
+}
+
+func isReplicate(cmd string, args []interface{}) bool {
+	return strings.EqualFold(cmd, "CLUSTER") && len(args) == 2 &&
+		strings.EqualFold(fmt.Sprint(args[0]), "REPLICATE")
+}
+
+// Whether the node knows the node ID, or may know it after a captured
+// CLUSTER MEET.
+func (self *dryRunConn) knows(id string) bool {
+	self.d.mu.Lock()
+	met := self.d.met
+	self.d.mu.Unlock()
+	if met {
+		return true
+	}
+	nodes, err := redis.String(self.Conn.Do("CLUSTER", "NODES"))
+	return err != nil || strings.Contains(nodes, id)
+}
+
+func (self *dryRunConn) Send(cmd string, args ...interface{}) error {
+	if !isReadOnly(cmd, args) {
+		self.d.capture(self.addr, cmd, args)
+		return nil
+	}
+	return self.Conn.Send(cmd, args...)
+}
@@ -0,0 +1,62 @@
+package redistrib_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func TestDryRunLeavesClusterUnchanged(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	keys := fill(t, c, 0, 1)
+	source, target := c.SlotOwner(0), c.SlotOwner(16383)
+
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(c.Dialer())
+	d := redistrib.NewDryRun()
+	rt.SetDryRun(d)
+	if err := rt.LoadCluster(c.Addrs()[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	journal := redistrib.NewJournal("", "reshard")
+	journal.AddMoves(rt.ComputeReshardTable(redistrib.ClusterArray{node(t, rt, source)}, 2), node(t, rt, target))
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, slot := range []int{0, 1} {
+		if owner := c.SlotOwner(slot); owner != source {
+			t.Errorf("slot %d moved to %s by the dry run", slot, owner.Addr())
+		}
+	}
+	for _, key := range keys {
+		if _, ok := source.Get(key); !ok {
+			t.Errorf("key %s migrated by the dry run", key)
+		}
+	}
+	for _, n := range c.Nodes() {
+		for _, cmd := range n.Commands() {
+			if strings.EqualFold(cmd[0], "MIGRATE") || len(cmd) > 1 && strings.EqualFold(cmd[1], "SETSLOT") {
+				t.Errorf("dry run sent %v to %s", cmd, n.Addr())
+			}
+		}
+	}
+
+	// importing, migrating, then the owner on the 3 masters, per slot
+	want := map[string]int{"CLUSTER SETSLOT": 2 * 5, "MIGRATE": 2}
+	got := make(map[string]int)
+	for _, cmd := range d.Commands() {
+		name := strings.ToUpper(cmd.Args[0])
+		if name == "CLUSTER" {
+			name += " " + strings.ToUpper(cmd.Args[1])
+		}
+		got[name]++
+	}
+	for name, count := range want {
+		if got[name] != count {
+			t.Errorf("dry run captured %d %s, want %d (all: %v)", got[name], name, count, got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package redistrib
+
+import (
+	"fmt"
+)
+
+// Kind of the errors returned by the cluster operations, so callers can
+// tell a failure worth a retry from one that needs a human.
+type ErrorKind int
+
+const (
+	ErrUnknown ErrorKind = iota
+	ErrBadArgument
+	ErrBadAddress
+	ErrConnection
+	ErrNotClusterNode
+	ErrNodeNotEmpty
+	ErrClusterUnhealthy
+	ErrSlotConflict
+	ErrMigrate
+	ErrAborted
+	ErrConfig
+	ErrFailover
+	ErrRestart
+)
+
+var errorKindNames = map[ErrorKind]string{
+	ErrUnknown:          "unknown error",
+	ErrBadArgument:      "bad argument",
+	ErrBadAddress:       "bad address",
+	ErrConnection:       "connection failure",
+	ErrNotClusterNode:   "not a cluster node",
+	ErrNodeNotEmpty:     "node not empty",
+	ErrClusterUnhealthy: "cluster unhealthy",
+	ErrSlotConflict:     "slot conflict",
+	ErrMigrate:          "migrate failure",
+	ErrAborted:          "aborted",
+	ErrConfig:           "config failure",
+	ErrFailover:         "failover failure",
+	ErrRestart:          "restart failure",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+	return errorKindNames[ErrUnknown]
+}
+
+// Error returned by the cluster operations.
+type Error struct {
+	Kind ErrorKind
+	// Address of the node involved, if any.
+	Node string
+	Msg  string
+	// Underlying error, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	msg := e.Msg
+	if e.Node != "" {
+		msg = fmt.Sprintf("%s (node %s)", msg, e.Node)
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %s", msg, e.Err)
+	}
+	return msg
+}
+
+func NewError(kind ErrorKind, node string, err error, format string, args ...interface{}) *Error {
+	return &Error{
+		Kind: kind,
+		Node: node,
+		Msg:  fmt.Sprintf(format, args...),
+		Err:  err,
+	}
+}
+
+// Return the kind of err, ErrUnknown if it is not an *Error.
+func KindOf(err error) ErrorKind {
+	if e, ok := err.(*Error); ok {
+		return e.Kind
+	}
+	return ErrUnknown
+}
@@ -0,0 +1,218 @@
+package redistrib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// A master moved off a host, and the replica promoted in its place.
+type EvacuatedMaster struct {
+	Master      string `json:"master"`
+	MasterAddr  string `json:"master_addr"`
+	Replica     string `json:"replica"`
+	ReplicaAddr string `json:"replica_addr"`
+}
+
+// Record of the masters moved off a host, so that
+// RestoreHost can give them their role back after the maintenance.
+type Evacuation struct {
+	Host    string             `json:"host"`
+	Created time.Time          `json:"created"`
+	Masters []*EvacuatedMaster `json:"masters"`
+
+	// file the evacuation was loaded from or saved to
+	path string
+}
+
+func LoadEvacuation(path string) (*Evacuation, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read evacuation %s failed: %s", path, err)
+	}
+
+	e := &Evacuation{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("parse evacuation %s failed: %s", path, err)
+	}
+	e.path = path
+	return e, nil
+}
+
+// Write the evacuation to a temporary file first and rename it, like the
+// journals.
+func (self *Evacuation) Save(path string) error {
+	data, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write evacuation %s failed: %s", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	self.path = path
+	return nil
+}
+
+// Save the evacuation along with the one already recorded at path, as
+// when evacuate runs again after a failure: the masters failed over by
+// the earlier run must be restored too.
+func (self *Evacuation) Record(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		previous, err := LoadEvacuation(path)
+		if err != nil {
+			return err
+		}
+		if err := self.Merge(previous); err != nil {
+			return fmt.Errorf("%s in %s", err, path)
+		}
+	}
+	return self.Save(path)
+}
+
+// Delete the evacuation file once every master is restored, so that the
+// next maintenance of the host starts from scratch.
+func (self *Evacuation) Remove() error {
+	if self.path == "" {
+		return nil
+	}
+	if err := os.Remove(self.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove evacuation %s failed: %s", self.path, err)
+	}
+	return nil
+}
+
+// The masters serving slots on the host.
+func (self *RedisTrib) MastersOn(host string) []*ClusterNode {
+	var masters []*ClusterNode
+	for _, node := range self.Masters() {
+		if node.Host() == host && len(node.Slots()) > 0 {
+			masters = append(masters, node)
+		}
+	}
+	return masters
+}
+
+// Record the failovers of FailoverHost moving the masters off the host.
+func NewEvacuation(host string, results []*FailoverResult) *Evacuation {
+	e := &Evacuation{Host: host, Created: time.Now(), Masters: []*EvacuatedMaster{}}
+	for _, r := range results {
+		e.Masters = append(e.Masters, &EvacuatedMaster{
+			Master:      r.Master.Name(),
+			MasterAddr:  r.Master.String(),
+			Replica:     r.Replica.Name(),
+			ReplicaAddr: r.Replica.String(),
+		})
+	}
+	return e
+}
+
+// Add the masters of a previous evacuation of the host not restored yet,
+// so that RestoreHost brings back the masters of every run. The masters
+// evacuated again keep their latest record.
+func (self *Evacuation) Merge(previous *Evacuation) error {
+	if previous.Host != self.Host {
+		return fmt.Errorf("the evacuation recorded is of %s, not %s", previous.Host, self.Host)
+	}
+
+	again := make(map[string]bool)
+	for _, m := range self.Masters {
+		again[m.Master] = true
+	}
+	var masters []*EvacuatedMaster
+	for _, m := range previous.Masters {
+		if !again[m.Master] {
+			masters = append(masters, m)
+		}
+	}
+	self.Masters = append(masters, self.Masters...)
+	self.Created = previous.Created
+	return nil
+}
+
+// Give a replica on another host to the masters having none outside the
+// host, taken from the masters having more than one there.
+func (self *RedisTrib) RehomeReplicas(host string) error {
+	shards := self.shards()
+	away := func(s *shard) []*ClusterNode {
+		var replicas []*ClusterNode
+		for _, r := range s.replicas {
+			if r.Host() != host && !r.HasFlag("fail") {
+				replicas = append(replicas, r)
+			}
+		}
+		return replicas
+	}
+
+	for _, s := range shards {
+		if len(away(s)) > 0 {
+			continue
+		}
+		var moved *ClusterNode
+		for _, t := range shards {
+			replicas := away(t)
+			if t == s || len(replicas) < 2 {
+				continue
+			}
+			for _, r := range replicas {
+				if r.Host() != s.master.Host() {
+					moved = r
+					t.remove(r)
+					break
+				}
+			}
+			if moved != nil {
+				break
+			}
+		}
+		if moved == nil {
+			logrus.Warnf("*** No spare replica for master %s, its replicas are all on %s.", s.master.String(), host)
+			continue
+		}
+
+		logrus.Printf(">>> Moving replica %s to master %s", moved.String(), s.master.String())
+		if _, err := moved.ClusterReplicateWithNodeID(s.master.Name()); err != nil {
+			return NewError(ErrUnknown, moved.String(), err, "Failed to replicate master %s", s.master.String())
+		}
+		moved.info.replicate = s.master.Name()
+		s.replicas = append(s.replicas, moved)
+	}
+	return nil
+}
+
+// Fail the evacuated masters back over to their host, skipping the ones
+// already masters again. The evacuation file is removed once they all are,
+// and kept when one fails so that the restore can run again.
+func (self *RedisTrib) RestoreHost(e *Evacuation, o *FailoverOpts) ([]*FailoverResult, error) {
+	var results []*FailoverResult
+	for _, m := range e.Masters {
+		node := self.GetNodeByName(m.Master)
+		if node == nil {
+			return results, NewError(ErrFailover, m.MasterAddr, nil, "Evacuated master %s is not reachable", m.Master)
+		}
+		if node.HasFlag("master") {
+			logrus.Printf("*** %s is already a master.", node.String())
+			continue
+		}
+		result, err := self.Failover(node, o)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+
+	if self.dryRun == nil {
+		if err := e.Remove(); err != nil {
+			logrus.Warnf("%s", err)
+		}
+	}
+	return results, nil
+}
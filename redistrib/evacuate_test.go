@@ -0,0 +1,176 @@
+package redistrib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+func TestEvacuationMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "evacuate.json")
+	first := &redistrib.Evacuation{Host: "10.0.0.1", Created: time.Now().Add(-time.Hour), Masters: []*redistrib.EvacuatedMaster{
+		{Master: "a", Replica: "a1"},
+		{Master: "b", Replica: "b1"},
+	}}
+	if err := first.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second run evacuates b again, to another replica, and c
+	previous, err := redistrib.LoadEvacuation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := &redistrib.Evacuation{Host: "10.0.0.1", Created: time.Now(), Masters: []*redistrib.EvacuatedMaster{
+		{Master: "b", Replica: "b2"},
+		{Master: "c", Replica: "c1"},
+	}}
+	if err := second.Merge(previous); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a/a1", "b/b2", "c/c1"}
+	if len(second.Masters) != len(want) {
+		t.Fatalf("merged %d masters, want %v", len(second.Masters), want)
+	}
+	for i, m := range second.Masters {
+		if got := m.Master + "/" + m.Replica; got != want[i] {
+			t.Errorf("master %d is %s, want %s", i, got, want[i])
+		}
+	}
+	if !second.Created.Equal(previous.Created) {
+		t.Errorf("merged evacuation created %s, want the first run %s", second.Created, previous.Created)
+	}
+
+	other := &redistrib.Evacuation{Host: "10.0.0.2"}
+	if err := other.Merge(previous); err == nil {
+		t.Error("merged the evacuation of another host")
+	}
+}
+
+// Two masters on 127.0.0.1 with their replicas on 127.0.0.2, and a master
+// on 127.0.0.2 with its replica on 127.0.0.1.
+func newTwoHostCluster(t *testing.T) *redistest.Cluster {
+	t.Helper()
+	c, err := redistest.NewCluster(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	for _, host := range []string{"127.0.0.1", "127.0.0.1", "127.0.0.2", "127.0.0.2", "127.0.0.2", "127.0.0.1"} {
+		if _, err := c.AddNodeOn(host); err != nil {
+			t.Skipf("no %s loopback address: %s", host, err)
+		}
+	}
+	if err := c.Bootstrap(1); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// Evacuate the host as the evacuate command does, recording the
+// failovers at path.
+func evacuate(t *testing.T, c *redistest.Cluster, host, path string) {
+	t.Helper()
+	rt := load(t, c)
+	results, err := rt.FailoverHost(host, &redistrib.FailoverOpts{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := redistrib.NewEvacuation(host, results).Record(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Restore the host recorded at path, as the restore-host command does.
+func restore(rt *redistrib.RedisTrib, path string) error {
+	e, err := redistrib.LoadEvacuation(path)
+	if err != nil {
+		return err
+	}
+	_, err = rt.RestoreHost(e, &redistrib.FailoverOpts{Timeout: 5 * time.Second})
+	return err
+}
+
+func TestEvacuateRestoreEvacuate(t *testing.T) {
+	c := newTwoHostCluster(t)
+	nodes := c.Nodes()
+	first, second := nodes[0], nodes[1]
+	path := filepath.Join(t.TempDir(), "evacuate.json")
+
+	evacuate(t, c, "127.0.0.1", path)
+	if first.Master() == nil || second.Master() == nil {
+		t.Fatal("masters of 127.0.0.1 not evacuated")
+	}
+	if err := restore(load(t, c), path); err != nil {
+		t.Fatal(err)
+	}
+	if first.Master() != nil || second.Master() != nil {
+		t.Fatal("masters of 127.0.0.1 not restored")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("evacuation %s left after the restore: %v", path, err)
+	}
+
+	// the operator demotes the first master on purpose, then the host is
+	// evacuated again: only the second master is recorded
+	rt := load(t, c)
+	if _, err := rt.Failover(node(t, rt, firstReplicaOf(t, c, first)), &redistrib.FailoverOpts{Timeout: 5 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	evacuate(t, c, "127.0.0.1", path)
+	e, err := redistrib.LoadEvacuation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Masters) != 1 || e.Masters[0].Master != second.ID() {
+		t.Errorf("second evacuation recorded %d masters, want only %s", len(e.Masters), second.Addr())
+	}
+	if err := restore(load(t, c), path); err != nil {
+		t.Fatal(err)
+	}
+	if first.Master() == nil {
+		t.Errorf("demoted master %s restored from a stale evacuation", first.Addr())
+	}
+}
+
+func TestRestoreHostKeepsStateOnFailure(t *testing.T) {
+	c := newTwoHostCluster(t)
+	second := c.Nodes()[1]
+	path := filepath.Join(t.TempDir(), "evacuate.json")
+
+	evacuate(t, c, "127.0.0.1", path)
+	second.Close()
+	if err := restore(load(t, c), path); err == nil {
+		t.Fatal("restore succeeded with an evacuated master down")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("evacuation removed after a failed restore: %v", err)
+	}
+
+	if err := second.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	if err := restore(load(t, c), path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("evacuation %s left after the restore: %v", path, err)
+	}
+}
+
+// The replica of the master.
+func firstReplicaOf(t *testing.T, c *redistest.Cluster, master *redistest.Node) *redistest.Node {
+	t.Helper()
+	for _, n := range c.Nodes() {
+		if n.Master() == master {
+			return n
+		}
+	}
+	t.Fatalf("%s has no replica", master.Addr())
+	return nil
+}
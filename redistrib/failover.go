@@ -0,0 +1,265 @@
+package redistrib
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Modes of CLUSTER FAILOVER.
+const (
+	// The replica waits for its master to stop the clients and catch up.
+	FailoverDefault = ""
+	// The replica does not wait for its master, which may be down.
+	FailoverForce = "force"
+	// The replica does not even wait for the other masters to agree.
+	FailoverTakeover = "takeover"
+)
+
+// Time to wait for every node to see a failover when not given.
+const FailoverDefaultTimeout = 60 * time.Second
+
+// Time to wait for the initial sync of a new replica when not given, the
+// full copy of a dataset of several GB takes minutes.
+const ReplicaSyncDefaultTimeout = time.Hour
+
+// Replication offset a replica may lag behind its master when not given:
+// a master taking writes is always a little ahead, but a replica a
+// megabyte behind is still catching up.
+const FailoverDefaultMaxLag = 1 << 20
+
+// Any lag of the replicas is accepted, as long as their link to the master
+// is up.
+const NoMaxLag = -1
+
+// Options of the failovers.
+type FailoverOpts struct {
+	// FailoverDefault, FailoverForce or FailoverTakeover.
+	Mode string
+	// Replication offset a replica may lag behind its master, or
+	// NoMaxLag.
+	MaxLag int64
+	// Time to wait for every node to see the new roles.
+	Timeout time.Duration
+}
+
+// A failover done.
+type FailoverResult struct {
+	Replica *ClusterNode
+	// The previous master, nil when it is not reachable.
+	Master *ClusterNode
+	Took   time.Duration
+}
+
+// The replication offset the replica is behind its master.
+func ReplicationLag(replica, master *ClusterNode) (int64, error) {
+	fields, err := replica.InfoFields("replication")
+	if err != nil {
+		return 0, err
+	}
+	if fields["role"] != "slave" {
+		return 0, fmt.Errorf("role is %s", fields["role"])
+	}
+	if link := fields["master_link_status"]; link != "up" {
+		return 0, fmt.Errorf("link to the master is %s", link)
+	}
+	offset, err := strconv.ParseInt(fields["slave_repl_offset"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad slave_repl_offset %q", fields["slave_repl_offset"])
+	}
+
+	fields, err = master.InfoFields("replication")
+	if err != nil {
+		return 0, err
+	}
+	masterOffset, err := strconv.ParseInt(fields["master_repl_offset"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad master_repl_offset %q", fields["master_repl_offset"])
+	}
+	if masterOffset < offset {
+		return 0, nil
+	}
+	return masterOffset - offset, nil
+}
+
+// Wait until the replica has its link to the master up and is at most
+// maxLag behind it, unless NoMaxLag, after its initial sync.
+func (self *RedisTrib) WaitReplicaSync(replica, master *ClusterNode, maxLag int64, timeout time.Duration) error {
+	if self.dryRun != nil {
+		// the replica was not configured
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = ReplicaSyncDefaultTimeout
+	}
+
+	start := time.Now()
+	deadline, report := start.Add(timeout), start.Add(time.Minute)
+	for {
+		lag, err := ReplicationLag(replica, master)
+		if err == nil && (maxLag < 0 || lag <= maxLag) {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("%d behind its master", lag)
+		}
+		now := time.Now()
+		if now.After(deadline) {
+			return NewError(ErrFailover, replica.String(), err, "Replica not in sync after %s", timeout)
+		}
+		// a full sync may take long, show it is still going on
+		if now.After(report) {
+			logrus.Printf("*** %s still syncing after %s: %s", replica.String(), now.Sub(start).Round(time.Second), err)
+			report = now.Add(time.Minute)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// Promote the replica with CLUSTER FAILOVER, and wait until every node
+// sees it as a master. Unless forced, the replica must be in sync with
+// its master.
+func (self *RedisTrib) Failover(replica *ClusterNode, o *FailoverOpts) (*FailoverResult, error) {
+	if !replica.HasFlag("slave") || replica.Replicate() == "" {
+		return nil, NewError(ErrBadArgument, replica.String(), nil, "Node is not a replica")
+	}
+	masterID := replica.Replicate()
+	master := self.GetNodeByName(masterID)
+
+	if master == nil {
+		if o.Mode == FailoverDefault {
+			return nil, NewError(ErrFailover, replica.String(), nil,
+				"The master %s of the replica is not reachable, use --force", masterID)
+		}
+		logrus.Warnf("*** The master %s of %s is not reachable, skipping the sync check.", masterID, replica.String())
+	} else {
+		lag, err := ReplicationLag(replica, master)
+		if err == nil && o.MaxLag >= 0 && lag > o.MaxLag {
+			err = fmt.Errorf("%d behind its master", lag)
+		}
+		if err != nil {
+			if o.Mode == FailoverDefault {
+				return nil, NewError(ErrFailover, replica.String(), err, "Replica not in sync")
+			}
+			logrus.Warnf("*** Replica %s not in sync: %s", replica.String(), err)
+		}
+	}
+
+	what := "failover"
+	if o.Mode != FailoverDefault {
+		what = "failover " + o.Mode
+	}
+	from := masterID
+	if master != nil {
+		from = master.String()
+	}
+	logrus.Printf(">>> Performing %s of %s to %s", what, from, replica.String())
+	start := time.Now()
+	if _, err := replica.ClusterFailover(o.Mode); err != nil {
+		return nil, NewError(ErrFailover, replica.String(), err, "CLUSTER FAILOVER failed")
+	}
+	if err := self.waitFailover(replica, masterID, o.Timeout); err != nil {
+		return nil, err
+	}
+	return &FailoverResult{Replica: replica, Master: master, Took: time.Since(start)}, nil
+}
+
+// Wait until every node sees the replica as a master, and its previous
+// master, unless failing, as its replica.
+func (self *RedisTrib) waitFailover(replica *ClusterNode, masterID string, timeout time.Duration) error {
+	if self.dryRun != nil {
+		// the failover was not sent
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = FailoverDefaultTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		node, err := self.failoverPending(replica.Name(), masterID)
+		if node == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return NewError(ErrFailover, node.String(), err,
+				"Node does not see %s as master after %s", replica.String(), timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// The first node not seeing the failover yet, nil when all of them do.
+func (self *RedisTrib) failoverPending(replicaID, masterID string) (*ClusterNode, error) {
+	for _, node := range self.Nodes() {
+		view, err := node.ClusterNodesView()
+		if err != nil {
+			return node, err
+		}
+		if r := view[replicaID]; r == nil || !r.HasFlag("master") {
+			return node, nil
+		}
+		m := view[masterID]
+		if m == nil || m.HasFlag("fail") {
+			continue
+		}
+		if !m.HasFlag("slave") || m.Replicate() != replicaID {
+			return node, nil
+		}
+	}
+	return nil, nil
+}
+
+// The replica of the master to promote: reachable, not on the host to
+// leave, and the least behind.
+func (self *RedisTrib) failoverCandidate(master *ClusterNode, host string) (*ClusterNode, error) {
+	var best *ClusterNode
+	var bestLag int64
+	var lastErr error
+	for _, replica := range master.ReplicasNodes() {
+		if replica.Host() == host || replica.HasFlag("fail") {
+			continue
+		}
+		lag, err := ReplicationLag(replica, master)
+		if err != nil {
+			lastErr = NewError(ErrFailover, replica.String(), err, "Replica not in sync")
+			continue
+		}
+		if best == nil || lag < bestLag {
+			best, bestLag = replica, lag
+		}
+	}
+	if best == nil {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, NewError(ErrFailover, master.String(), nil, "No replica of the master outside %s", host)
+	}
+	return best, nil
+}
+
+// Fail over every master running on the host to one of its replicas on
+// another host, one master at a time, stopping at the first failure.
+func (self *RedisTrib) FailoverHost(host string, o *FailoverOpts) ([]*FailoverResult, error) {
+	var results []*FailoverResult
+	for _, master := range self.Masters() {
+		if master.Host() != host {
+			continue
+		}
+		if len(master.Slots()) == 0 && len(master.ReplicasNodes()) == 0 {
+			continue
+		}
+		replica, err := self.failoverCandidate(master, host)
+		if err != nil {
+			return results, err
+		}
+		result, err := self.Failover(replica, o)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
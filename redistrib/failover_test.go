@@ -0,0 +1,135 @@
+package redistrib_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+// The first replica of the cluster and its master.
+func firstReplica(t *testing.T, c *redistest.Cluster) (replica, master *redistest.Node) {
+	t.Helper()
+	for _, n := range c.Nodes() {
+		if m := n.Master(); m != nil {
+			return n, m
+		}
+	}
+	t.Fatal("no replica in the cluster")
+	return nil, nil
+}
+
+func TestFailover(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	replica, master := firstReplica(t, c)
+
+	rt := load(t, c)
+	result, err := rt.Failover(node(t, rt, replica), &redistrib.FailoverOpts{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Master == nil || result.Master.Name() != master.ID() {
+		t.Errorf("failover reports master %v, want %s", result.Master, master.Addr())
+	}
+	if replica.Master() != nil {
+		t.Errorf("%s is still a replica", replica.Addr())
+	}
+	if master.Master() != replica {
+		t.Errorf("%s does not replicate %s", master.Addr(), replica.Addr())
+	}
+}
+
+func TestFailoverRefusesMaster(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	_, master := firstReplica(t, c)
+
+	rt := load(t, c)
+	_, err := rt.Failover(node(t, rt, master), &redistrib.FailoverOpts{Timeout: 5 * time.Second})
+	if redistrib.KindOf(err) != redistrib.ErrBadArgument {
+		t.Errorf("failover of a master returned %v, want a bad argument", err)
+	}
+}
+
+func TestFailoverTakeoverOfFailedMaster(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	replica, master := firstReplica(t, c)
+	master.Close()
+
+	rt := load(t, c)
+	if _, err := rt.Failover(node(t, rt, replica), &redistrib.FailoverOpts{Timeout: 5 * time.Second}); redistrib.KindOf(err) != redistrib.ErrFailover {
+		t.Errorf("default failover with the master down returned %v, want a failover failure", err)
+	}
+	result, err := rt.Failover(node(t, rt, replica), &redistrib.FailoverOpts{
+		Mode:    redistrib.FailoverTakeover,
+		Timeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Master != nil {
+		t.Errorf("failover reports the failed master %s", result.Master.String())
+	}
+	for _, slot := range []int{0, 16383} {
+		if owner := c.SlotOwner(slot); owner.IsDown() {
+			t.Errorf("slot %d still owned by the failed master", slot)
+		}
+	}
+}
+
+func TestFailoverHost(t *testing.T) {
+	c, err := redistest.NewCluster(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	// masters on 127.0.0.1 and 127.0.0.2, their replicas on the other host
+	for _, host := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.2", "127.0.0.1"} {
+		if _, err := c.AddNodeOn(host); err != nil {
+			t.Skipf("no %s loopback address: %s", host, err)
+		}
+	}
+	if err := c.Bootstrap(1); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := load(t, c)
+	results, err := rt.FailoverHost("127.0.0.1", &redistrib.FailoverOpts{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("%d failovers, want 1", len(results))
+	}
+	for _, n := range c.Nodes() {
+		host, _, _ := net.SplitHostPort(n.Addr())
+		if n.Master() == nil && len(n.Slots()) > 0 && host == "127.0.0.1" {
+			t.Errorf("master %s left on the host", n.Addr())
+		}
+	}
+}
+
+func TestFailoverMaxLag(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	replica, master := firstReplica(t, c)
+	master.Set("key", "value")
+	replica.SetLag(1)
+
+	rt := load(t, c)
+	_, err := rt.Failover(node(t, rt, replica), &redistrib.FailoverOpts{MaxLag: 0, Timeout: 5 * time.Second})
+	if redistrib.KindOf(err) != redistrib.ErrFailover {
+		t.Fatalf("failover of a lagging replica with a max lag of 0 returned %v, want a failover failure", err)
+	}
+	if replica.Master() != master {
+		t.Fatalf("%s promoted despite its lag", replica.Addr())
+	}
+
+	// a write behind is within the default lag
+	if _, err := rt.Failover(node(t, rt, replica), &redistrib.FailoverOpts{MaxLag: redistrib.FailoverDefaultMaxLag, Timeout: 5 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if replica.Master() != nil {
+		t.Errorf("%s is still a replica", replica.Addr())
+	}
+}
@@ -0,0 +1,286 @@
+package redistrib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	JournalSlotPending   = "pending"
+	JournalSlotMigrating = "migrating"
+	JournalSlotDone      = "done"
+)
+
+// One slot of a reshard/rebalance plan and how far its migration got.
+type JournalEntry struct {
+	Slot   int    `json:"slot"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+}
+
+// On-disk record of a slot migration plan. The file is rewritten after
+// every state change, so when a run dies partway through it tells which
+// slots were moved, which one was in flight and which are still pending.
+type Journal struct {
+	Command string          `json:"command"`
+	Created time.Time       `json:"created"`
+	Entries []*JournalEntry `json:"entries"`
+
+	path string
+}
+
+func NewJournal(path string, command string) *Journal {
+	return &Journal{
+		Command: command,
+		Created: time.Now(),
+		path:    path,
+	}
+}
+
+func LoadJournal(path string) (*Journal, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read journal %s failed: %s", path, err)
+	}
+
+	j := &Journal{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("parse journal %s failed: %s", path, err)
+	}
+	j.path = path
+	return j, nil
+}
+
+func (self *Journal) Path() string {
+	return self.path
+}
+
+func (self *Journal) SetPath(path string) {
+	self.path = path
+}
+
+// Append the moves of a reshard table, all of them going to target.
+func (self *Journal) AddMoves(table []*MovedNode, target *ClusterNode) {
+	for _, e := range table {
+		self.Entries = append(self.Entries, &JournalEntry{
+			Slot:   e.Slot,
+			Source: e.Source.Name(),
+			Target: target.Name(),
+			Status: JournalSlotPending,
+		})
+	}
+}
+
+// Append the moves of a reshard table like AddMoves, and update the
+// logical config of the nodes while planning, so that the next table
+// computed for the same source picks other slots.
+func (self *Journal) PlanMoves(table []*MovedNode, target *ClusterNode) {
+	self.AddMoves(table, target)
+	for _, e := range table {
+		e.Source.DelSlot(e.Slot)
+		target.AssignSlot(e.Slot)
+	}
+}
+
+func (self *Journal) Pending() int {
+	count := 0
+	for _, e := range self.Entries {
+		if e.Status != JournalSlotDone {
+			count += 1
+		}
+	}
+	return count
+}
+
+func (self *Journal) SetStatus(e *JournalEntry, status string) error {
+	e.Status = status
+	return self.Save()
+}
+
+// Write the journal to a temporary file first and rename it, so that a
+// crash never leaves a truncated journal behind. A journal without path
+// is only kept in memory.
+func (self *Journal) Save() error {
+	if self.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := self.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write journal %s failed: %s", tmp, err)
+	}
+	return os.Rename(tmp, self.path)
+}
+
+// Delete the journal file once every move is done, there is nothing left
+// to resume.
+func (self *Journal) Remove() error {
+	if self.path == "" {
+		return nil
+	}
+	if err := os.Remove(self.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove journal %s failed: %s", self.path, err)
+	}
+	return nil
+}
+
+// Check that the live topology still matches the journal: every node it
+// mentions is a known master, finished slots are owned by their target,
+// the others are still owned by their source, and the only open slots in
+// the cluster are the ones the journal left in flight.
+func (self *RedisTrib) ValidateJournal(j *Journal) error {
+	if !self.isConfigConsistent() {
+		return NewError(ErrClusterUnhealthy, "", nil, "nodes don't agree about configuration, can't resume %s", j.Path())
+	}
+	if len(self.CoveredSlots()) != ClusterHashSlots {
+		return NewError(ErrClusterUnhealthy, "", nil, "not all %d slots are covered by nodes, can't resume %s", ClusterHashSlots, j.Path())
+	}
+
+	inflight := make(map[int]*JournalEntry)
+	for _, e := range j.Entries {
+		source := self.GetNodeByName(e.Source)
+		target := self.GetNodeByName(e.Target)
+		if source == nil || source.HasFlag("slave") {
+			return NewError(ErrSlotConflict, "", nil, "slot %d: source %s is not a known master", e.Slot, e.Source)
+		}
+		if target == nil || target.HasFlag("slave") {
+			return NewError(ErrSlotConflict, "", nil, "slot %d: target %s is not a known master", e.Slot, e.Target)
+		}
+
+		// While the ownership is being broadcast the source and the
+		// target of the in-flight slot may both claim it.
+		owners := self.GetSlotOwners(e.Slot)
+		if e.Status == JournalSlotMigrating {
+			for _, owner := range owners {
+				if owner != source && owner != target {
+					return NewError(ErrSlotConflict, "", nil, "slot %d is owned by %s, neither source nor target of its move", e.Slot, owner.Name())
+				}
+			}
+			inflight[e.Slot] = e
+			continue
+		}
+
+		if len(owners) != 1 {
+			return NewError(ErrSlotConflict, "", nil, "slot %d has %d owners", e.Slot, len(owners))
+		}
+		owner := owners[0]
+
+		if e.Status == JournalSlotDone && owner != target {
+			return NewError(ErrSlotConflict, "", nil, "slot %d was moved to %s but is now owned by %s", e.Slot, e.Target, owner.Name())
+		} else if e.Status != JournalSlotDone && owner != source {
+			return NewError(ErrSlotConflict, "", nil, "slot %d should still be owned by %s but is owned by %s", e.Slot, e.Source, owner.Name())
+		}
+	}
+
+	for _, node := range self.Nodes() {
+		for slot, nodeid := range node.Migrating() {
+			e, ok := inflight[slot]
+			if !ok || !strings.EqualFold(node.Name(), e.Source) || !strings.EqualFold(nodeid, e.Target) {
+				return NewError(ErrSlotConflict, "", nil, "node %s has slot %d in migrating state not recorded in the journal", node.String(), slot)
+			}
+		}
+		for slot, nodeid := range node.Importing() {
+			e, ok := inflight[slot]
+			if !ok || !strings.EqualFold(node.Name(), e.Target) || !strings.EqualFold(nodeid, e.Source) {
+				return NewError(ErrSlotConflict, "", nil, "node %s has slot %d in importing state not recorded in the journal", node.String(), slot)
+			}
+		}
+	}
+	return nil
+}
+
+// Move every slot of the journal that is not done yet, recording each
+// step so that an interrupted run can be resumed with ResumeJournal. The
+// journal file is removed once all the slots are moved.
+func (self *RedisTrib) RunJournal(j *Journal, opts *MoveOpts, progress func(*JournalEntry)) error {
+	if self.dryRun != nil {
+		// Nothing is really moved, leave the journal file as it is.
+		path := j.Path()
+		j.SetPath("")
+		defer j.SetPath(path)
+	}
+
+	for _, e := range j.Entries {
+		if e.Status == JournalSlotDone {
+			continue
+		}
+
+		source := self.GetNodeByName(e.Source)
+		target := self.GetNodeByName(e.Target)
+		if source == nil || target == nil {
+			return NewError(ErrSlotConflict, "", nil, "slot %d: unknown node in journal %s", e.Slot, j.Path())
+		}
+
+		var err error
+		if e.Status == JournalSlotMigrating && self.ownsSlot(target, e.Slot) {
+			// The previous run died after all the keys were moved, while
+			// the new owner was being broadcast: just finish that.
+			err = self.SetSlotOwner(e.Slot, source, target)
+		} else {
+			if err = j.SetStatus(e, JournalSlotMigrating); err != nil {
+				return err
+			}
+			err = self.MoveSlot(&MovedNode{Source: source, Slot: e.Slot}, target, opts)
+		}
+		if err != nil {
+			return err
+		}
+		if opts.Update {
+			source.DelSlot(e.Slot)
+			target.AssignSlot(e.Slot)
+		}
+		if err := j.SetStatus(e, JournalSlotDone); err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(e)
+		}
+	}
+
+	if err := j.Remove(); err != nil {
+		logrus.Warnf("%s", err)
+	}
+	return nil
+}
+
+func (self *RedisTrib) ownsSlot(node *ClusterNode, slot int) bool {
+	for _, owner := range self.GetSlotOwners(slot) {
+		if owner == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Load the journal at path, check it against the loaded topology and
+// move the slots that were not finished by the previous run.
+func (self *RedisTrib) ResumeJournal(path string, command string, opts *MoveOpts, progress func(*JournalEntry)) error {
+	j, err := LoadJournal(path)
+	if err != nil {
+		return err
+	}
+	if j.Command != command {
+		return NewError(ErrBadArgument, "", nil, "journal %s was written by %s, not by %s", path, j.Command, command)
+	}
+
+	if err := self.ValidateJournal(j); err != nil {
+		return err
+	}
+
+	logrus.Printf(">>> Resuming %s from %s: %d of %d slots left to move.",
+		command, path, j.Pending(), len(j.Entries))
+	return self.RunJournal(j, opts, progress)
+}
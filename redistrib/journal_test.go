@@ -0,0 +1,140 @@
+package redistrib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func TestRunJournalMovesSlots(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	slots := []int{0, 1, 2, 3, 4}
+	keys := fill(t, c, slots...)
+	source, target := c.SlotOwner(0), c.SlotOwner(16383)
+
+	rt := load(t, c)
+	dst := node(t, rt, target)
+	owned := len(dst.Slots())
+	path := filepath.Join(t.TempDir(), "reshard.journal")
+	journal := redistrib.NewJournal(path, "reshard")
+	journal.AddMoves(rt.ComputeReshardTable(redistrib.ClusterArray{node(t, rt, source)}, len(slots)), dst)
+	if err := journal.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, slot := range slots {
+		if owner := c.SlotOwner(slot); owner != target {
+			t.Errorf("slot %d owned by %s, want %s", slot, owner.Addr(), target.Addr())
+		}
+	}
+	for _, key := range keys {
+		if _, ok := target.Get(key); !ok {
+			t.Errorf("key %s not migrated", key)
+		}
+	}
+	if got := len(dst.Slots()); got != owned+len(slots) {
+		t.Errorf("target has %d slots in the logical config, want %d", got, owned+len(slots))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal %s left after the run: %v", path, err)
+	}
+}
+
+func TestResumeJournal(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	slots := []int{0, 1, 2, 3, 4, 5}
+	fill(t, c, slots...)
+	source, target := c.SlotOwner(0), c.SlotOwner(16383)
+
+	rt := load(t, c)
+	path := filepath.Join(t.TempDir(), "reshard.journal")
+	journal := redistrib.NewJournal(path, "reshard")
+	journal.AddMoves(rt.ComputeReshardTable(redistrib.ClusterArray{node(t, rt, source)}, len(slots)), node(t, rt, target))
+	if err := journal.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// MIGRATE fails on the slot after the first two.
+	done := 0
+	err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, func(e *redistrib.JournalEntry) {
+		if done++; done == 2 {
+			source.DisableCommand("migrate")
+		}
+	})
+	if redistrib.KindOf(err) != redistrib.ErrMigrate {
+		t.Fatalf("interrupted run returned %v, want a migrate failure", err)
+	}
+
+	saved, err := redistrib.LoadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := make(map[string]int)
+	for _, e := range saved.Entries {
+		status[e.Status]++
+	}
+	want := map[string]int{
+		redistrib.JournalSlotDone:      2,
+		redistrib.JournalSlotMigrating: 1,
+		redistrib.JournalSlotPending:   len(slots) - 3,
+	}
+	for s, n := range want {
+		if status[s] != n {
+			t.Errorf("%d slots %s in the journal, want %d", status[s], s, n)
+		}
+	}
+
+	source.EnableCommand("migrate")
+	rt = load(t, c)
+	opts := &redistrib.MoveOpts{Update: true, Quiet: true}
+	if err := rt.ResumeJournal(path, "rebalance", opts, nil); redistrib.KindOf(err) != redistrib.ErrBadArgument {
+		t.Errorf("resume as rebalance returned %v, want a bad argument", err)
+	}
+	if err := rt.ResumeJournal(path, "reshard", opts, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, slot := range slots {
+		if owner := c.SlotOwner(slot); owner != target {
+			t.Errorf("slot %d owned by %s after the resume, want %s", slot, owner.Addr(), target.Addr())
+		}
+	}
+	for _, n := range load(t, c).Nodes() {
+		if len(n.Migrating()) > 0 || len(n.Importing()) > 0 {
+			t.Errorf("%s has open slots after the resume", n.String())
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("journal %s left after the resume: %v", path, err)
+	}
+}
+
+func TestResumeJournalRejectsChangedTopology(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	source, target, other := c.SlotOwner(0), c.SlotOwner(16383), c.SlotOwner(8192)
+
+	rt := load(t, c)
+	path := filepath.Join(t.TempDir(), "reshard.journal")
+	journal := redistrib.NewJournal(path, "reshard")
+	journal.AddMoves(rt.ComputeReshardTable(redistrib.ClusterArray{node(t, rt, source)}, 1), node(t, rt, target))
+	if err := journal.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The slot went elsewhere meanwhile.
+	for _, n := range c.Nodes() {
+		if _, err := n.Do("CLUSTER", "SETSLOT", "0", "NODE", other.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rt = load(t, c)
+	err := rt.ResumeJournal(path, "reshard", &redistrib.MoveOpts{Update: true, Quiet: true}, nil)
+	if redistrib.KindOf(err) != redistrib.ErrSlotConflict {
+		t.Errorf("resume returned %v, want a slot conflict", err)
+	}
+}
@@ -0,0 +1,116 @@
+package redistrib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// One slot move of an exported plan.
+type PlanMove struct {
+	Slot   int    `json:"slot"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Keys   int    `json:"keys"`
+}
+
+// Slot moves computed by reshard or rebalance, written with --plan-out
+// so they can be reviewed before being run with apply-plan.
+type Plan struct {
+	Command string      `json:"command"`
+	Created time.Time   `json:"created"`
+	Moves   []*PlanMove `json:"moves"`
+}
+
+// Build a plan from the entries of a journal, estimating the keys of
+// every slot with CLUSTER COUNTKEYSINSLOT on its source node.
+func (self *RedisTrib) NewPlan(j *Journal) *Plan {
+	plan := &Plan{
+		Command: j.Command,
+		Created: time.Now(),
+	}
+
+	for _, e := range j.Entries {
+		keys := 0
+		if source := self.GetNodeByName(e.Source); source != nil {
+			keys, _ = source.ClusterCountKeysInSlot(e.Slot)
+		}
+		plan.Moves = append(plan.Moves, &PlanMove{
+			Slot:   e.Slot,
+			Source: e.Source,
+			Target: e.Target,
+			Keys:   keys,
+		})
+	}
+	return plan
+}
+
+// Write the plan of the journal to path, for apply-plan to run it later.
+func (self *RedisTrib) WritePlan(path string, j *Journal) error {
+	plan := self.NewPlan(j)
+	if err := plan.Save(path); err != nil {
+		return fmt.Errorf("write plan %s failed: %s", path, err)
+	}
+	logrus.Printf(">>> Plan of %d slots (about %d keys) written to %s", len(plan.Moves), plan.Keys(), path)
+	return nil
+}
+
+func LoadPlan(path string) (*Plan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read plan %s failed: %s", path, err)
+	}
+
+	plan := &Plan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("parse plan %s failed: %s", path, err)
+	}
+
+	seen := make(map[int]bool)
+	for _, m := range plan.Moves {
+		if m.Slot < 0 || m.Slot >= ClusterHashSlots {
+			return nil, NewError(ErrBadArgument, "", nil, "plan %s: invalid slot %d", path, m.Slot)
+		}
+		if seen[m.Slot] {
+			return nil, NewError(ErrBadArgument, "", nil, "plan %s: slot %d is moved more than once", path, m.Slot)
+		}
+		if m.Source == m.Target {
+			return nil, NewError(ErrBadArgument, "", nil, "plan %s: slot %d has the same source and target", path, m.Slot)
+		}
+		seen[m.Slot] = true
+	}
+	return plan, nil
+}
+
+func (self *Plan) Save(path string) error {
+	data, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (self *Plan) Keys() int {
+	keys := 0
+	for _, m := range self.Moves {
+		keys += m.Keys
+	}
+	return keys
+}
+
+// Turn the plan into a journal with every slot still pending.
+func (self *Plan) Journal(path string, command string) *Journal {
+	j := NewJournal(path, command)
+	for _, m := range self.Moves {
+		j.Entries = append(j.Entries, &JournalEntry{
+			Slot:   m.Slot,
+			Source: m.Source,
+			Target: m.Target,
+			Status: JournalSlotPending,
+		})
+	}
+	return j
+}
@@ -0,0 +1,123 @@
+package redistrib_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+// Export the plan moving the first slots of the master owning slot 0 to
+// the one owning slot 16383, as reshard --plan-out does.
+func exportPlan(t *testing.T, c *redistest.Cluster, slots int) string {
+	t.Helper()
+	rt := load(t, c)
+	journal := redistrib.NewJournal("", "reshard")
+	journal.AddMoves(rt.ComputeReshardTable(redistrib.ClusterArray{node(t, rt, c.SlotOwner(0))}, slots), node(t, rt, c.SlotOwner(16383)))
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := rt.WritePlan(path, journal); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Load the plan and check it against the cluster, as apply-plan does.
+func applyPlan(t *testing.T, c *redistest.Cluster, path string) error {
+	t.Helper()
+	plan, err := redistrib.LoadPlan(path)
+	if err != nil {
+		return err
+	}
+	rt := load(t, c)
+	journal := plan.Journal(filepath.Join(t.TempDir(), "apply-plan.journal"), "apply-plan")
+	if err := rt.ValidateJournal(journal); err != nil {
+		return err
+	}
+	return rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil)
+}
+
+func TestApplyPlan(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	source, target := c.SlotOwner(0), c.SlotOwner(16383)
+	keys := fill(t, c, 0, 1, 2)
+	path := exportPlan(t, c, 3)
+
+	plan, err := redistrib.LoadPlan(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Moves) != 3 || plan.Keys() != len(keys) {
+		t.Errorf("plan of %d moves and %d keys, want 3 moves and %d keys", len(plan.Moves), plan.Keys(), len(keys))
+	}
+	for _, m := range plan.Moves {
+		if m.Source != source.ID() || m.Target != target.ID() {
+			t.Errorf("slot %d planned from %s to %s", m.Slot, m.Source, m.Target)
+		}
+	}
+
+	if err := applyPlan(t, c, path); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range plan.Moves {
+		if owner := c.SlotOwner(m.Slot); owner != target {
+			t.Errorf("slot %d owned by %s after apply-plan, want %s", m.Slot, owner.Addr(), target.Addr())
+		}
+	}
+	for _, key := range keys {
+		if _, ok := target.Get(key); !ok {
+			t.Errorf("key %s not migrated", key)
+		}
+	}
+}
+
+func TestApplyPlanRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *redistest.Cluster, plan *redistrib.Plan)
+		kind redistrib.ErrorKind
+	}{
+		{"duplicate slot", func(c *redistest.Cluster, plan *redistrib.Plan) {
+			plan.Moves[1].Slot = plan.Moves[0].Slot
+		}, redistrib.ErrBadArgument},
+		{"invalid slot", func(c *redistest.Cluster, plan *redistrib.Plan) {
+			plan.Moves[0].Slot = redistrib.ClusterHashSlots
+		}, redistrib.ErrBadArgument},
+		{"same source and target", func(c *redistest.Cluster, plan *redistrib.Plan) {
+			plan.Moves[0].Target = plan.Moves[0].Source
+		}, redistrib.ErrBadArgument},
+		{"unknown node", func(c *redistest.Cluster, plan *redistrib.Plan) {
+			plan.Moves[0].Target = "0000000000000000000000000000000000000000"
+		}, redistrib.ErrSlotConflict},
+		{"topology changed", func(c *redistest.Cluster, plan *redistrib.Plan) {
+			// the slot went to the third master since the export
+			other := c.SlotOwner(8192).ID()
+			for _, n := range c.Nodes() {
+				n.Do("CLUSTER", "SETSLOT", "0", "NODE", other)
+			}
+		}, redistrib.ErrSlotConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCluster(t, 3, 0)
+			source := c.SlotOwner(0)
+			path := exportPlan(t, c, 2)
+			plan, err := redistrib.LoadPlan(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(c, plan)
+			if err := plan.Save(path); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := applyPlan(t, c, path); redistrib.KindOf(err) != tt.kind {
+				t.Errorf("apply-plan returned %v, want a %s", err, tt.kind)
+			}
+			if owner := c.SlotOwner(1); owner != source {
+				t.Errorf("slot 1 moved by a rejected plan")
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package redistrib
+
+import (
+	"math"
+	"sort"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Options of the rebalance planner.
+type RebalanceOpts struct {
+	// Weight of the masters by node ID, the masters not listed weigh 1.
+	Weights map[string]int
+	// Also give slots to the masters that don't have any.
+	UseEmptyMasters bool
+	// Percentage of difference between the expected number of slots and
+	// the real one under which a master is considered balanced.
+	Threshold int
+	Verbose   bool
+	// What the masters balance, RebalanceBySlots by default.
+	By string
+	// Weigh the masters without an explicit weight by their memory
+	// capacity, in MB.
+	AutoWeights bool
+	// Slots counted or sampled per round trip, keys sampled per slot for
+	// RebalanceByMemory.
+	Pipeline int
+	Samples  int
+}
+
+// What RebalancePlan balances across the masters.
+const (
+	RebalanceBySlots  = "slots"
+	RebalanceByKeys   = "keys"
+	RebalanceByMemory = "memory"
+)
+
+// Keys sampled per slot by MEMORY USAGE when not given.
+const RebalanceDefaultSamples = 5
+
+// Compute the slot moves that balance the masters according to their
+// weights, as a journal with every slot pending. A nil journal is
+// returned when all the masters are within the threshold. The logical
+// config of the nodes is updated with the planned moves.
+func (self *RedisTrib) RebalancePlan(o *RebalanceOpts) (*Journal, error) {
+	totalWeight, nodesInvolved, err := self.assignWeights(o)
+	if err != nil {
+		return nil, err
+	}
+	switch o.By {
+	case "", RebalanceBySlots:
+	case RebalanceByKeys, RebalanceByMemory:
+		return self.costRebalancePlan(o, totalWeight, nodesInvolved)
+	default:
+		return nil, NewError(ErrBadArgument, "", nil, "Unknown rebalance mode %s", o.By)
+	}
+
+	// Calculate the slots balance for each node. It's the number of
+	// slots the node should lose (if positive) or gain (if negative)
+	// in order to be balanced.
+	threshold := o.Threshold
+	thresholdReached := false
+	for _, node := range self.Nodes() {
+		if node.HasFlag("master") {
+			if node.Weight() == 0 {
+				continue
+			}
+			expected := int((float64(ClusterHashSlots) / float64(totalWeight)) * float64(node.Weight()))
+			node.SetBalance(len(node.Slots()) - expected)
+			// Compute the percentage of difference between the
+			// expected number of slots and the real one, to see
+			// if it's over the threshold specified by the user.
+			overThreshold := false
+
+			if threshold > 0 {
+				if len(node.Slots()) > 0 {
+					errPerc := math.Abs(float64(100 - (100.0*expected)/len(node.Slots())))
+					if int(errPerc) > threshold {
+						overThreshold = true
+					}
+				} else if expected > 0 {
+					overThreshold = true
+				}
+			}
+
+			if overThreshold {
+				thresholdReached = true
+			}
+		}
+	}
+	if !thresholdReached {
+		logrus.Printf("*** No rebalancing needed! All nodes are within the %d threshold.", threshold)
+		return nil, nil
+	}
+
+	// Only consider nodes we want to change
+	var sn BalanceArray
+	for _, node := range self.Nodes() {
+		if node.HasFlag("master") && node.Weight() != 0 {
+			sn = append(sn, node)
+		}
+	}
+
+	// Because of rounding, it is possible that the balance of all nodes
+	// summed does not give 0. Make sure that nodes that have to provide
+	// slots are always matched by nodes receiving slots.
+	totalBalance := 0
+	for _, node := range sn {
+		totalBalance += node.Balance()
+	}
+
+	for totalBalance > 0 {
+		for _, node := range sn {
+			if node.Balance() < 0 && totalBalance > 0 {
+				b := node.Balance() - 1
+				node.SetBalance(b)
+				totalBalance -= 1
+			}
+		}
+	}
+
+	// Sort nodes by their slots balance.
+	sort.Sort(BalanceArray(sn))
+
+	logrus.Printf(">>> Rebalancing across %d nodes. Total weight = %d", nodesInvolved, totalWeight)
+
+	if o.Verbose {
+		for _, node := range sn {
+			logrus.Printf("%s balance is %d slots", node.String(), node.Balance())
+		}
+	}
+
+	// Now we have at the start of the 'sn' array nodes that should get
+	// slots, at the end nodes that must give slots.
+	// We take two indexes, one at the start, and one at the end,
+	// incrementing or decrementing the indexes accordingly til we
+	// find nodes that need to get/provide slots.
+	dstIdx := 0
+	srcIdx := len(sn) - 1
+	journal := NewJournal("", "rebalance")
+
+	for dstIdx < srcIdx {
+		dst := sn[dstIdx]
+		src := sn[srcIdx]
+
+		var numSlots float64
+		if math.Abs(float64(dst.Balance())) < math.Abs(float64(src.Balance())) {
+			numSlots = math.Abs(float64(dst.Balance()))
+		} else {
+			numSlots = math.Abs(float64(src.Balance()))
+		}
+
+		if numSlots > 0 {
+			logrus.Printf("Moving %d slots from %s to %s", int(numSlots), src.String(), dst.String())
+
+			srcs := ClusterArray{src}
+			reshardTable := self.ComputeReshardTable(srcs, int(numSlots))
+			if len(reshardTable) != int(numSlots) {
+				return nil, NewError(ErrUnknown, "", nil, "*** Assertio failed: Reshard table != number of slots")
+			}
+			journal.PlanMoves(reshardTable, dst)
+		}
+
+		// Update nodes balance.
+		dst.SetBalance(dst.Balance() + int(numSlots))
+		src.SetBalance(src.Balance() - int(numSlots))
+		if dst.Balance() == 0 {
+			dstIdx += 1
+		}
+		if src.Balance() == 0 {
+			srcIdx -= 1
+		}
+	}
+
+	return journal, nil
+}
+
+// Assign a weight to each master, and compute the total cluster weight.
+func (self *RedisTrib) assignWeights(o *RebalanceOpts) (totalWeight, nodesInvolved int, err error) {
+	for _, node := range self.Nodes() {
+		if node.HasFlag("master") {
+			if !o.UseEmptyMasters && len(node.Slots()) == 0 {
+				continue
+			}
+			if w, ok := o.Weights[node.Name()]; ok {
+				node.SetWeight(w)
+			} else if o.AutoWeights {
+				capacity, err := node.MemoryCapacity()
+				if err != nil {
+					return 0, 0, NewError(ErrConnection, node.String(), err, "Read the memory capacity failed")
+				}
+				if capacity == 0 {
+					return 0, 0, NewError(ErrBadArgument, node.String(), nil, "Node has no maxmemory to weigh it, use --weight")
+				}
+				node.SetWeight(int(capacity>>20) + 1)
+			} else {
+				node.SetWeight(1)
+			}
+			if o.Verbose {
+				logrus.Printf("%s weight is %d", node.String(), node.Weight())
+			}
+
+			totalWeight += node.Weight()
+			nodesInvolved += 1
+		}
+	}
+	return totalWeight, nodesInvolved, nil
+}
+
+// The cost of every slot of the weighted masters: its number of keys or
+// the estimated memory used by its keys.
+func (self *RedisTrib) slotCosts(o *RebalanceOpts) (map[int]int64, error) {
+	pipeline, samples := o.Pipeline, o.Samples
+	if pipeline <= 0 {
+		pipeline = SlotStatsDefaultPipeline
+	}
+	if samples <= 0 {
+		samples = RebalanceDefaultSamples
+	}
+
+	costs := make(map[int]int64)
+	for _, node := range self.Nodes() {
+		if !node.HasFlag("master") || node.Weight() == 0 || len(node.Slots()) == 0 {
+			continue
+		}
+		slots := make([]int, 0, len(node.Slots()))
+		for slot := range node.Slots() {
+			slots = append(slots, slot)
+		}
+		sort.Ints(slots)
+
+		counts, err := node.ClusterCountKeysInSlots(slots, pipeline)
+		if err != nil {
+			return nil, NewError(ErrConnection, node.String(), err, "Count keys in slots failed")
+		}
+		if o.By == RebalanceByKeys {
+			for slot, n := range counts {
+				costs[slot] = int64(n)
+			}
+			continue
+		}
+		usage, err := node.SlotsMemoryUsage(counts, samples, pipeline)
+		if err != nil {
+			return nil, NewError(ErrConnection, node.String(), err, "Sample memory usage failed")
+		}
+		for slot, n := range usage {
+			costs[slot] = n
+		}
+	}
+	return costs, nil
+}
+
+// Plan the moves balancing the keys or the memory of the masters
+// according to their weights. The heaviest slots of the masters holding
+// too much move first, to the masters lacking the most, as long as the
+// moves bring the masters closer to their share.
+func (self *RedisTrib) costRebalancePlan(o *RebalanceOpts, totalWeight, nodesInvolved int) (*Journal, error) {
+	logrus.Printf(">>> Measuring the %s of every slot...", o.By)
+	costs, err := self.slotCosts(o)
+	if err != nil {
+		return nil, err
+	}
+
+	var sn []*ClusterNode
+	var total int64
+	for _, node := range self.Nodes() {
+		if node.HasFlag("master") && node.Weight() != 0 {
+			sn = append(sn, node)
+			for slot := range node.Slots() {
+				total += costs[slot]
+			}
+		}
+	}
+	if total == 0 {
+		logrus.Printf("*** No rebalancing needed! The cluster holds no %s.", o.By)
+		return nil, nil
+	}
+
+	// The cost each node should lose (if positive) or gain (if negative).
+	balance := make(map[*ClusterNode]float64)
+	thresholdReached := false
+	for _, node := range sn {
+		var cost int64
+		for slot := range node.Slots() {
+			cost += costs[slot]
+		}
+		expected := float64(total) * float64(node.Weight()) / float64(totalWeight)
+		balance[node] = float64(cost) - expected
+
+		if cost > 0 {
+			errPerc := math.Abs(100 - 100*expected/float64(cost))
+			if int(errPerc) > o.Threshold {
+				thresholdReached = true
+			}
+		} else if expected > 0 {
+			thresholdReached = true
+		}
+		if o.Verbose {
+			logrus.Printf("%s balance is %.0f %s", node.String(), balance[node], o.By)
+		}
+	}
+	if !thresholdReached {
+		logrus.Printf("*** No rebalancing needed! All nodes are within the %d threshold.", o.Threshold)
+		return nil, nil
+	}
+
+	logrus.Printf(">>> Rebalancing %s across %d nodes. Total weight = %d", o.By, nodesInvolved, totalWeight)
+
+	// The sources, the node holding the most first.
+	sort.SliceStable(sn, func(i, j int) bool { return balance[sn[i]] > balance[sn[j]] })
+	journal := NewJournal("", "rebalance")
+	for _, src := range sn {
+		if balance[src] <= 0 {
+			break
+		}
+		slots := make([]int, 0, len(src.Slots()))
+		for slot := range src.Slots() {
+			if costs[slot] > 0 {
+				slots = append(slots, slot)
+			}
+		}
+		sort.Slice(slots, func(i, j int) bool {
+			if costs[slots[i]] != costs[slots[j]] {
+				return costs[slots[i]] > costs[slots[j]]
+			}
+			return slots[i] < slots[j]
+		})
+
+		moved := 0
+		for _, slot := range slots {
+			dst := sn[len(sn)-1]
+			for _, node := range sn {
+				if balance[node] < balance[dst] {
+					dst = node
+				}
+			}
+			give, need, c := balance[src], -balance[dst], float64(costs[slot])
+			if give <= 0 || need <= 0 {
+				break
+			}
+			// Only move when the sum of the differences to the shares
+			// decreases.
+			if math.Abs(give-c)+math.Abs(need-c) >= give+need {
+				continue
+			}
+
+			journal.PlanMoves([]*MovedNode{{Source: src, Slot: slot}}, dst)
+			balance[src] -= c
+			balance[dst] += c
+			moved += 1
+		}
+		if moved > 0 {
+			logrus.Printf("Moving %d slots from %s", moved, src.String())
+		}
+	}
+	return journal, nil
+}
+
+///////////////////////////////////////////////////////////
+// some useful struct contains cluster node.
+type BalanceArray []*ClusterNode
+
+func (b BalanceArray) Len() int {
+	return len(b)
+}
+
+func (b BalanceArray) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
+
+func (b BalanceArray) Less(i, j int) bool {
+	return b[i].Balance() < b[j].Balance()
+}
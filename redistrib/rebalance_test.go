@@ -0,0 +1,108 @@
+package redistrib_test
+
+import (
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func TestRebalanceUsesEmptyMasters(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	empty, err := c.AddNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	meet(t, c, empty)
+
+	rt := load(t, c)
+	journal, err := rt.RebalancePlan(&redistrib.RebalanceOpts{
+		UseEmptyMasters: true,
+		Threshold:       redistrib.RebalanceDefaultThreshold,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if journal == nil {
+		t.Fatal("no rebalance planned")
+	}
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range c.Nodes() {
+		if got := len(n.Slots()); got < 4095 || got > 4097 {
+			t.Errorf("%s has %d slots, want 4096", n.Addr(), got)
+		}
+	}
+
+	// Balanced now, nothing more to do.
+	journal, err = load(t, c).RebalancePlan(&redistrib.RebalanceOpts{
+		UseEmptyMasters: true,
+		Threshold:       redistrib.RebalanceDefaultThreshold,
+	})
+	if err != nil || journal != nil {
+		t.Errorf("second rebalance planned %v, %v", journal, err)
+	}
+}
+
+func TestRebalanceWeights(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	heavy := c.SlotOwner(0)
+
+	rt := load(t, c)
+	journal, err := rt.RebalancePlan(&redistrib.RebalanceOpts{
+		Weights:   map[string]int{heavy.ID(): 2},
+		Threshold: redistrib.RebalanceDefaultThreshold,
+	})
+	if err != nil || journal == nil {
+		t.Fatalf("rebalance planned %v, %v", journal, err)
+	}
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(heavy.Slots()); got < 8191 || got > 8193 {
+		t.Errorf("master of weight 2 has %d slots, want 8192", got)
+	}
+}
+
+func TestRebalanceAutoWeights(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	heavy := c.SlotOwner(0)
+	for _, n := range c.Nodes() {
+		maxmemory := "1073741824"
+		if n == heavy {
+			maxmemory = "2147483648"
+		}
+		if _, err := n.Do("CONFIG", "SET", "maxmemory", maxmemory); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rt := load(t, c)
+	journal, err := rt.RebalancePlan(&redistrib.RebalanceOpts{
+		AutoWeights: true,
+		Threshold:   redistrib.RebalanceDefaultThreshold,
+	})
+	if err != nil || journal == nil {
+		t.Fatalf("rebalance planned %v, %v", journal, err)
+	}
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(heavy.Slots()); got < 8190 || got > 8194 {
+		t.Errorf("master of twice the maxmemory has %d slots, want 8192", got)
+	}
+}
+
+func TestRebalanceAutoWeightsWithoutMaxmemory(t *testing.T) {
+	c := newCluster(t, 3, 0)
+
+	_, err := load(t, c).RebalancePlan(&redistrib.RebalanceOpts{
+		AutoWeights: true,
+		Threshold:   redistrib.RebalanceDefaultThreshold,
+	})
+	if redistrib.KindOf(err) != redistrib.ErrBadArgument {
+		t.Errorf("rebalance by the maxmemory of nodes without any: %v, want a bad argument", err)
+	}
+}
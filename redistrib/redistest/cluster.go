@@ -0,0 +1,656 @@
+package redistest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// Cluster is a set of fake nodes. The nodes share the slot table, a slot
+// assigned on one node is seen by every node knowing the owner at once.
+type Cluster struct {
+	mu    sync.Mutex
+	nodes []*Node
+	slots [redistrib.ClusterHashSlots]*Node
+	// current epoch of the cluster
+	epoch int
+	// the nodes also accept TLS connections when set
+	tlsConfig *tls.Config
+}
+
+// Start n empty cluster nodes, none of them knows the others.
+func NewCluster(n int) (*Cluster, error) {
+	c := &Cluster{}
+	for i := 0; i < n; i++ {
+		if _, err := c.AddNode(); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Start a new empty cluster node.
+func (c *Cluster) AddNode() (*Node, error) {
+	return c.start(true, "127.0.0.1")
+}
+
+// Start a new empty cluster node listening on another loopback address,
+// such as 127.0.0.2, to stand for a node on another host.
+func (c *Cluster) AddNodeOn(host string) (*Node, error) {
+	return c.start(true, host)
+}
+
+// Start a node with cluster mode disabled, like the source instance of
+// the import command.
+func (c *Cluster) AddStandalone() (*Node, error) {
+	return c.start(false, "127.0.0.1")
+}
+
+func (c *Cluster) start(clusterEnabled bool, host string) (*Node, error) {
+	n := &Node{
+		cluster:        c,
+		id:             newNodeID(),
+		clusterEnabled: clusterEnabled,
+		known:          make(map[*Node]bool),
+		keys:           make(map[string]string),
+		migrating:      make(map[int]*Node),
+		importing:      make(map[int]*Node),
+		config:         defaultConfig(),
+		conns:          make(map[net.Conn]bool),
+	}
+	if err := n.listen(net.JoinHostPort(host, "0")); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	config := c.tlsConfig
+	c.mu.Unlock()
+	if config != nil {
+		if err := n.listenTLS(net.JoinHostPort(host, "0"), config); err != nil {
+			n.Close()
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	c.nodes = append(c.nodes, n)
+	c.mu.Unlock()
+	return n, nil
+}
+
+// Make every node, and the ones added later, accept TLS connections on a
+// second port with the config, like tls-port next to port. CLUSTER NODES
+// advertises it in the tls-port auxiliary field.
+func (c *Cluster) ListenTLS(config *tls.Config) error {
+	c.mu.Lock()
+	c.tlsConfig = config
+	c.mu.Unlock()
+
+	for _, n := range c.Nodes() {
+		host, _, _ := net.SplitHostPort(n.Addr())
+		if err := n.listenTLS(net.JoinHostPort(host, "0"), config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop every node.
+func (c *Cluster) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range c.nodes {
+		n.stop()
+	}
+}
+
+func (c *Cluster) Nodes() []*Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Node(nil), c.nodes...)
+}
+
+// Addresses of the nodes, as host:port.
+func (c *Cluster) Addrs() []string {
+	var addrs []string
+	for _, n := range c.Nodes() {
+		addrs = append(addrs, n.Addr())
+	}
+	return addrs
+}
+
+// Make a ready to use cluster out of the nodes, the way the create
+// command does: every node knows the others, the first nodes are masters
+// sharing the slots evenly and the others replicate them in turn.
+func (c *Cluster) Bootstrap(replicas int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var nodes []*Node
+	for _, n := range c.nodes {
+		if n.clusterEnabled {
+			nodes = append(nodes, n)
+		}
+	}
+	masters := len(nodes) / (replicas + 1)
+	if masters == 0 {
+		return errors.New("redistest: not enough nodes")
+	}
+
+	for _, n := range nodes {
+		for _, other := range nodes {
+			if n != other {
+				n.known[other] = true
+			}
+		}
+	}
+
+	for i, m := range nodes[:masters] {
+		first := i * redistrib.ClusterHashSlots / masters
+		last := (i + 1) * redistrib.ClusterHashSlots / masters
+		for slot := first; slot < last; slot++ {
+			c.slots[slot] = m
+		}
+		c.epoch++
+		m.epoch = c.epoch
+	}
+	for i, n := range nodes[masters:] {
+		n.master = nodes[i%masters]
+	}
+	return nil
+}
+
+// Dialer connecting to the nodes in process through pipes, bypassing
+// TCP. The connections send AUTH with the credentials of DefaultAuth.
+func (c *Cluster) Dialer() redistrib.Dialer {
+	return redistrib.DialerFunc(func(addr string) (redistrib.Conn, error) {
+		c.mu.Lock()
+		n := c.nodeByAddr(addr)
+		if n == nil || n.down {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("dial tcp %s: connection refused", addr)
+		}
+		client, server := net.Pipe()
+		n.conns[server] = true
+		c.mu.Unlock()
+
+		go n.serve(server)
+		conn := redis.NewConn(client, 0, 0)
+		if err := redistrib.DefaultAuth.Authenticate(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	})
+}
+
+// Node owning the slot, nil if the slot is not assigned.
+func (c *Cluster) SlotOwner(slot int) *Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.slots[slot]
+}
+
+// Node with the address, nil if there is none.
+func (c *Cluster) NodeByAddr(addr string) *Node {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nodeByAddr(addr)
+}
+
+func (c *Cluster) nodeByAddr(addr string) *Node {
+	for _, n := range c.nodes {
+		if n.addr == addr || (n.tlsAddr != "" && n.tlsAddr == addr) {
+			return n
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) nodeByID(id string) *Node {
+	for _, n := range c.nodes {
+		if n.id == id {
+			return n
+		}
+	}
+	return nil
+}
+
+func (c *Cluster) slotsOf(n *Node) []int {
+	var slots []int
+	for slot, owner := range c.slots {
+		if owner == n {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+// Node is a fake Redis server listening on the loopback interface.
+type Node struct {
+	cluster        *Cluster
+	id             string
+	addr           string
+	clusterEnabled bool
+	listener       net.Listener
+	conns          map[net.Conn]bool
+	down           bool
+	// address and listener of the TLS port, if any
+	tlsAddr     string
+	tlsListener net.Listener
+
+	// config epoch of the node
+	epoch     int
+	master    *Node
+	known     map[*Node]bool
+	keys      map[string]string
+	migrating map[int]*Node
+	importing map[int]*Node
+	config    map[string]string
+	// number of writes, reported as the replication offset
+	offset int
+	// writes a replica has not received yet
+	lag      int
+	user     string
+	password string
+	commands [][]string
+	// commands replying an error, CONFIG SET as "config set"
+	disabled map[string]bool
+}
+
+func newNodeID() string {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func (n *Node) ID() string {
+	return n.id
+}
+
+// Address of the node, as host:port.
+func (n *Node) Addr() string {
+	return n.addr
+}
+
+func (n *Node) Port() int {
+	_, port, _ := net.SplitHostPort(n.addr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Address of the TLS port of the node, empty without ListenTLS.
+func (n *Node) TLSAddr() string {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	return n.tlsAddr
+}
+
+func (n *Node) tlsPort() int {
+	_, port, _ := net.SplitHostPort(n.tlsAddr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Master replicated by the node, nil for a master.
+func (n *Node) Master() *Node {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	return n.master
+}
+
+// Slots owned by the node, sorted.
+func (n *Node) Slots() []int {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	return n.cluster.slotsOf(n)
+}
+
+// Whether the node was stopped, by Close or a SHUTDOWN command.
+func (n *Node) IsDown() bool {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	return n.down
+}
+
+// Require the clients to AUTH with the password, and the user if not
+// empty, before any other command.
+func (n *Node) RequireAuth(user, password string) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	n.user = user
+	n.password = password
+}
+
+// Make the node reply an error to the command, given as "flushall" or
+// with its subcommand as "config set", to simulate a failure on one node.
+func (n *Node) DisableCommand(cmd string) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	if n.disabled == nil {
+		n.disabled = make(map[string]bool)
+	}
+	n.disabled[strings.ToLower(cmd)] = true
+}
+
+// Make the node run the command again after DisableCommand.
+func (n *Node) EnableCommand(cmd string) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	delete(n.disabled, strings.ToLower(cmd))
+}
+
+// Make a replica lag writes behind its master, until a failover makes
+// it catch up.
+func (n *Node) SetLag(writes int) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	n.lag = writes
+}
+
+// Store a key, whatever slot it hashes to. Keys written to a replica go
+// to its master.
+func (n *Node) Set(key, value string) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	n.write(func(keys map[string]string) {
+		keys[key] = value
+	})
+}
+
+func (n *Node) Get(key string) (string, bool) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	value, ok := n.data()[key]
+	return value, ok
+}
+
+// Keys stored by the node, sorted.
+func (n *Node) Keys() []string {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	return sortedKeys(n.data())
+}
+
+// Value of a configuration parameter, as CONFIG GET reports it.
+func (n *Node) Config(param string) string {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	return n.config[param]
+}
+
+// Commands received by the node so far, AUTH excluded.
+func (n *Node) Commands() [][]string {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	return append([][]string(nil), n.commands...)
+}
+
+// Run a command in process, as an authenticated client would. Error
+// replies are returned as errors.
+func (n *Node) Do(args ...string) (interface{}, error) {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	reply := n.exec(&connState{authed: true}, args)
+	if e, ok := reply.(replyError); ok {
+		return nil, errors.New(string(e))
+	}
+	return reply, nil
+}
+
+// Stop the node, the other nodes flag it as failing.
+func (n *Node) Close() {
+	n.cluster.mu.Lock()
+	defer n.cluster.mu.Unlock()
+	n.stop()
+}
+
+// Start again a stopped node on the same address, with its data and its
+// view of the cluster.
+func (n *Node) Restart() error {
+	n.cluster.mu.Lock()
+	down := n.down
+	n.cluster.mu.Unlock()
+	if !down {
+		return errors.New("redistest: node is running")
+	}
+	if err := n.listen(n.addr); err != nil {
+		return err
+	}
+
+	n.cluster.mu.Lock()
+	addr, config := n.tlsAddr, n.cluster.tlsConfig
+	n.cluster.mu.Unlock()
+	if addr != "" {
+		return n.listenTLS(addr, config)
+	}
+	return nil
+}
+
+func (n *Node) listen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	n.cluster.mu.Lock()
+	n.listener = l
+	n.addr = l.Addr().String()
+	n.down = false
+	n.cluster.mu.Unlock()
+
+	go n.accept(l)
+	return nil
+}
+
+func (n *Node) listenTLS(addr string, config *tls.Config) error {
+	l, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return err
+	}
+
+	n.cluster.mu.Lock()
+	n.tlsListener = l
+	n.tlsAddr = l.Addr().String()
+	n.cluster.mu.Unlock()
+
+	go n.accept(l)
+	return nil
+}
+
+func (n *Node) stop() {
+	if n.down {
+		return
+	}
+	n.down = true
+	n.listener.Close()
+	if n.tlsListener != nil {
+		n.tlsListener.Close()
+	}
+	for conn := range n.conns {
+		conn.Close()
+	}
+	n.conns = make(map[net.Conn]bool)
+}
+
+func (n *Node) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		n.cluster.mu.Lock()
+		if n.listener != l && n.tlsListener != l {
+			n.cluster.mu.Unlock()
+			conn.Close()
+			return
+		}
+		n.conns[conn] = true
+		n.cluster.mu.Unlock()
+
+		go n.serve(conn)
+	}
+}
+
+// State of a client connection.
+type connState struct {
+	authed bool
+	// the next command is allowed on an importing slot
+	asking bool
+	quit   bool
+}
+
+func (n *Node) serve(conn net.Conn) {
+	replies := newReplyQueue(conn)
+	defer func() {
+		n.cluster.mu.Lock()
+		delete(n.conns, conn)
+		n.cluster.mu.Unlock()
+		replies.Close()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(replies)
+	cs := &connState{}
+
+	for {
+		args, err := readCommand(r)
+		if err == errProtocol {
+			writeReply(w, errorf("ERR Protocol error"))
+			w.Flush()
+			return
+		} else if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		n.cluster.mu.Lock()
+		if cs.authed == false && n.password == "" {
+			cs.authed = true
+		}
+		reply := n.exec(cs, args)
+		down := n.down
+		n.cluster.mu.Unlock()
+
+		// SHUTDOWN closes the connection without a reply.
+		if down {
+			return
+		}
+		writeReply(w, reply)
+		if err := w.Flush(); err != nil || cs.quit {
+			return
+		}
+	}
+}
+
+// Replies waiting for a goroutine writing them to the connection. The
+// pipes of Dialer are synchronous, without it a client pipelining more
+// commands than fit in a buffer before reading the replies would block.
+type replyQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    []byte
+	closed bool
+	done   chan struct{}
+}
+
+func newReplyQueue(conn net.Conn) *replyQueue {
+	q := &replyQueue{done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run(conn)
+	return q
+}
+
+func (q *replyQueue) Write(p []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.buf = append(q.buf, p...)
+	q.cond.Signal()
+	return len(p), nil
+}
+
+func (q *replyQueue) run(conn net.Conn) {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.buf) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		buf, closed := q.buf, q.closed
+		q.buf = nil
+		q.mu.Unlock()
+
+		if len(buf) == 0 && closed {
+			return
+		}
+		if _, err := conn.Write(buf); err != nil {
+			return
+		}
+	}
+}
+
+// Write the queued replies and stop.
+func (q *replyQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Signal()
+	q.mu.Unlock()
+	<-q.done
+}
+
+// Map of the keys the node serves, the one of its master for a replica.
+func (n *Node) data() map[string]string {
+	for n.master != nil {
+		n = n.master
+	}
+	return n.keys
+}
+
+func (n *Node) write(f func(keys map[string]string)) {
+	m := n
+	for m.master != nil {
+		m = m.master
+	}
+	f(m.keys)
+	m.offset++
+}
+
+func defaultConfig() map[string]string {
+	return map[string]string{
+		"appendonly":                    "no",
+		"cluster-node-timeout":          "15000",
+		"cluster-require-full-coverage": "yes",
+		"maxmemory":                     "0",
+		"maxmemory-policy":              "noeviction",
+		"min-replicas-to-write":         "0",
+		"repl-backlog-size":             "1048576",
+		"save":                          "",
+		"timeout":                       "0",
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
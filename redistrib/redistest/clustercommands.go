@@ -0,0 +1,461 @@
+package redistest
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// CLUSTER subcommand [args ...]
+func (n *Node) clusterCmd(args []string) interface{} {
+	if len(args) == 0 {
+		return wrongArgs("cluster")
+	}
+	sub := strings.ToLower(args[0])
+	args = args[1:]
+	c := n.cluster
+
+	switch sub {
+	case "myid":
+		return n.id
+	case "nodes":
+		return n.clusterNodes()
+	case "info":
+		return n.clusterInfo()
+	case "keyslot":
+		if len(args) != 1 {
+			return wrongArgs("cluster|keyslot")
+		}
+		return int(redistrib.Key2Slot(args[0]))
+	case "countkeysinslot", "getkeysinslot":
+		return n.keysInSlot(sub, args)
+	case "addslots", "delslots":
+		slots, err := parseSlots(args)
+		if err != nil {
+			return err
+		}
+		for _, slot := range slots {
+			if sub == "addslots" && c.slots[slot] != nil {
+				return errorf("ERR Slot %d is already busy", slot)
+			}
+			if sub == "delslots" && c.slots[slot] == nil {
+				return errorf("ERR Slot %d is already unassigned", slot)
+			}
+		}
+		for _, slot := range slots {
+			if sub == "addslots" {
+				c.slots[slot] = n
+			} else {
+				c.slots[slot] = nil
+			}
+		}
+		return status("OK")
+	case "setslot":
+		return n.setSlot(args)
+	case "meet":
+		if len(args) < 2 {
+			return wrongArgs("cluster|meet")
+		}
+		other := c.nodeByAddr(net.JoinHostPort(args[0], args[1]))
+		if other == nil || !other.clusterEnabled {
+			return errorf("ERR Invalid node address specified: %s:%s", args[0], args[1])
+		}
+		n.meet(other)
+		return status("OK")
+	case "forget":
+		if len(args) != 1 {
+			return wrongArgs("cluster|forget")
+		}
+		other := c.nodeByID(args[0])
+		if other == n {
+			return replyError("ERR I tried hard but I can't forget myself...")
+		}
+		if other == nil || !n.known[other] {
+			return errorf("ERR Unknown node %s", args[0])
+		}
+		if n.master == other {
+			return replyError("ERR Can't forget my master!")
+		}
+		delete(n.known, other)
+		return status("OK")
+	case "replicate":
+		if len(args) != 1 {
+			return wrongArgs("cluster|replicate")
+		}
+		master := c.nodeByID(args[0])
+		if master == nil || !n.known[master] {
+			return errorf("ERR Unknown node %s", args[0])
+		}
+		if master == n {
+			return replyError("ERR Can't replicate myself")
+		}
+		if master.master != nil {
+			return replyError("ERR I can only replicate a master, not a replica.")
+		}
+		if n.master == nil && (len(c.slotsOf(n)) > 0 || len(n.keys) > 0) {
+			return replyError("ERR To set a master the node must be empty and without assigned slots.")
+		}
+		n.master = master
+		n.keys = make(map[string]string)
+		return status("OK")
+	case "failover":
+		return n.failover(args)
+	case "bumpepoch":
+		if n.epoch == 0 || n.epoch < c.epoch {
+			c.epoch++
+			n.epoch = c.epoch
+			return status(fmt.Sprintf("BUMPED %d", n.epoch))
+		}
+		return status(fmt.Sprintf("STILL %d", n.epoch))
+	case "set-config-epoch":
+		if len(args) != 1 {
+			return wrongArgs("cluster|set-config-epoch")
+		}
+		epoch, err := strconv.Atoi(args[0])
+		if err != nil || epoch < 0 {
+			return errorf("ERR Invalid config epoch specified: %s", args[0])
+		}
+		if len(n.known) > 0 {
+			return replyError("ERR The user can assign a config epoch only when the node does not know any other node.")
+		}
+		if n.epoch != 0 {
+			return replyError("ERR Node config epoch is already non-zero")
+		}
+		n.epoch = epoch
+		if epoch > c.epoch {
+			c.epoch = epoch
+		}
+		return status("OK")
+	}
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'", sub)
+}
+
+// The nodes learn each other at once, along with the nodes each of them
+// knows, as the gossip would eventually do.
+func (n *Node) meet(other *Node) {
+	group := map[*Node]bool{n: true, other: true}
+	for k := range n.known {
+		group[k] = true
+	}
+	for k := range other.known {
+		group[k] = true
+	}
+	for a := range group {
+		for b := range group {
+			if a != b {
+				a.known[b] = true
+			}
+		}
+	}
+}
+
+func parseSlots(args []string) ([]int, interface{}) {
+	if len(args) == 0 {
+		return nil, replyError("ERR wrong number of arguments for 'cluster|addslots' command")
+	}
+	var slots []int
+	seen := make(map[int]bool)
+	for _, arg := range args {
+		slot, err := parseSlot(arg)
+		if err != nil {
+			return nil, err
+		}
+		if seen[slot] {
+			return nil, errorf("ERR Slot %d specified multiple times", slot)
+		}
+		seen[slot] = true
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+func parseSlot(arg string) (int, interface{}) {
+	slot, err := strconv.Atoi(arg)
+	if err != nil || slot < 0 || slot >= redistrib.ClusterHashSlots {
+		return 0, replyError("ERR Invalid or out of range slot")
+	}
+	return slot, nil
+}
+
+// CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE node-id | STABLE
+func (n *Node) setSlot(args []string) interface{} {
+	if len(args) < 2 {
+		return wrongArgs("cluster|setslot")
+	}
+	slot, err := parseSlot(args[0])
+	if err != nil {
+		return err
+	}
+	c := n.cluster
+	action := strings.ToLower(args[1])
+
+	if action == "stable" {
+		delete(n.migrating, slot)
+		delete(n.importing, slot)
+		return status("OK")
+	}
+	if len(args) != 3 {
+		return replyError("ERR Invalid CLUSTER SETSLOT action or number of arguments")
+	}
+	other := c.nodeByID(args[2])
+	if other == nil || (other != n && !n.known[other]) {
+		return errorf("ERR I don't know about node %s", args[2])
+	}
+	if n.master != nil {
+		return replyError("ERR Please use SETSLOT only with masters.")
+	}
+
+	switch action {
+	case "migrating":
+		if c.slots[slot] != n {
+			return errorf("ERR I'm not the owner of hash slot %d", slot)
+		}
+		n.migrating[slot] = other
+	case "importing":
+		if c.slots[slot] == n {
+			return errorf("ERR I'm already the owner of hash slot %d", slot)
+		}
+		n.importing[slot] = other
+	case "node":
+		if c.slots[slot] == n && other != n && n.countKeysInSlot(slot) > 0 {
+			return errorf("ERR Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot)
+		}
+		if other == n {
+			delete(n.migrating, slot)
+			if _, ok := n.importing[slot]; ok {
+				delete(n.importing, slot)
+				c.epoch++
+				n.epoch = c.epoch
+			}
+		} else if n.countKeysInSlot(slot) == 0 {
+			delete(n.migrating, slot)
+		}
+		c.slots[slot] = other
+	default:
+		return replyError("ERR Invalid CLUSTER SETSLOT action or number of arguments")
+	}
+	return status("OK")
+}
+
+func (n *Node) countKeysInSlot(slot int) int {
+	count := 0
+	for key := range n.data() {
+		if int(redistrib.Key2Slot(key)) == slot {
+			count++
+		}
+	}
+	return count
+}
+
+// CLUSTER COUNTKEYSINSLOT slot | GETKEYSINSLOT slot count
+func (n *Node) keysInSlot(sub string, args []string) interface{} {
+	if (sub == "countkeysinslot" && len(args) != 1) || (sub == "getkeysinslot" && len(args) != 2) {
+		return wrongArgs("cluster|" + sub)
+	}
+	slot, err := parseSlot(args[0])
+	if err != nil {
+		return err
+	}
+	if sub == "countkeysinslot" {
+		return n.countKeysInSlot(slot)
+	}
+
+	count, e := strconv.Atoi(args[1])
+	if e != nil || count < 0 {
+		return replyError("ERR Invalid number of keys")
+	}
+	keys := []string{}
+	for _, key := range sortedKeys(n.data()) {
+		if len(keys) == count {
+			break
+		}
+		if int(redistrib.Key2Slot(key)) == slot {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Nodes known by n, itself first.
+func (n *Node) view() []*Node {
+	nodes := []*Node{n}
+	var others []*Node
+	for other := range n.known {
+		others = append(others, other)
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].id < others[j].id })
+	return append(nodes, others...)
+}
+
+// CLUSTER FAILOVER [FORCE|TAKEOVER], the replica takes over its master
+// a moment after the reply, as the real failover is asynchronous.
+func (n *Node) failover(args []string) interface{} {
+	if len(args) > 1 {
+		return wrongArgs("cluster|failover")
+	}
+	mode := ""
+	if len(args) == 1 {
+		mode = strings.ToLower(args[0])
+		if mode != "force" && mode != "takeover" {
+			return replyError("ERR syntax error")
+		}
+	}
+	if n.master == nil {
+		return replyError("ERR You should send CLUSTER FAILOVER to a replica")
+	}
+	if n.master.down && mode == "" {
+		return replyError("ERR Master is down or failed, please use CLUSTER FAILOVER FORCE")
+	}
+
+	c := n.cluster
+	time.AfterFunc(100*time.Millisecond, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		n.promote()
+	})
+	return status("OK")
+}
+
+// Make a replica the master of the slots, data and replicas of its master,
+// which becomes its replica.
+func (n *Node) promote() {
+	old := n.master
+	if old == nil {
+		return
+	}
+	c := n.cluster
+	for slot, owner := range c.slots {
+		if owner == old {
+			c.slots[slot] = n
+		}
+	}
+	for _, r := range c.nodes {
+		if r.master == old && r != n {
+			r.master = n
+		}
+	}
+	n.master = nil
+	n.keys = old.keys
+	n.offset = old.offset
+	n.lag = 0
+	old.master = n
+	old.keys = make(map[string]string)
+	c.epoch++
+	n.epoch = c.epoch
+}
+
+func (n *Node) clusterNodes() string {
+	var b strings.Builder
+	for _, m := range n.view() {
+		flags := "master"
+		master := "-"
+		if m.master != nil {
+			flags = "slave"
+			master = m.master.id
+		}
+		if m == n {
+			flags = "myself," + flags
+		}
+		link := "connected"
+		if m.down {
+			flags += ",fail"
+			link = "disconnected"
+		}
+		epoch := m.epoch
+		if m.master != nil {
+			epoch = m.master.epoch
+		}
+
+		addr := fmt.Sprintf("%s@%d", m.addr, m.Port()+10000)
+		if m.tlsAddr != "" {
+			// no hostname, then the auxiliary fields
+			addr += fmt.Sprintf(",,tls-port=%d", m.tlsPort())
+		}
+		fmt.Fprintf(&b, "%s %s %s %s 0 0 %d %s", m.id, addr, flags, master, epoch, link)
+		if m.master == nil {
+			for _, r := range ranges(n.cluster.slotsOf(m)) {
+				b.WriteString(" " + r)
+			}
+		}
+		if m == n {
+			for _, slot := range sortedSlots(n.migrating) {
+				fmt.Fprintf(&b, " [%d->-%s]", slot, n.migrating[slot].id)
+			}
+			for _, slot := range sortedSlots(n.importing) {
+				fmt.Fprintf(&b, " [%d-<-%s]", slot, n.importing[slot].id)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (n *Node) clusterInfo() string {
+	c := n.cluster
+	assigned, failed := 0, 0
+	for _, owner := range c.slots {
+		if owner != nil {
+			assigned++
+			if owner.down {
+				failed++
+			}
+		}
+	}
+
+	size := 0
+	for _, m := range n.view() {
+		if m.master == nil && len(c.slotsOf(m)) > 0 {
+			size++
+		}
+	}
+
+	state := "ok"
+	if assigned != redistrib.ClusterHashSlots || failed > 0 {
+		state = "fail"
+	}
+
+	lines := []string{
+		"cluster_state:" + state,
+		fmt.Sprintf("cluster_slots_assigned:%d", assigned),
+		fmt.Sprintf("cluster_slots_ok:%d", assigned-failed),
+		"cluster_slots_pfail:0",
+		fmt.Sprintf("cluster_slots_fail:%d", failed),
+		fmt.Sprintf("cluster_known_nodes:%d", len(n.known)+1),
+		fmt.Sprintf("cluster_size:%d", size),
+		fmt.Sprintf("cluster_current_epoch:%d", c.epoch),
+		fmt.Sprintf("cluster_my_epoch:%d", n.epoch),
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func sortedSlots(m map[int]*Node) []int {
+	slots := make([]int, 0, len(m))
+	for slot := range m {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+	return slots
+}
+
+// Format sorted slots as the ranges of CLUSTER NODES, like 0-5460.
+func ranges(slots []int) []string {
+	var result []string
+	for i := 0; i < len(slots); {
+		j := i
+		for j+1 < len(slots) && slots[j+1] == slots[j]+1 {
+			j++
+		}
+		if i == j {
+			result = append(result, strconv.Itoa(slots[i]))
+		} else {
+			result = append(result, fmt.Sprintf("%d-%d", slots[i], slots[j]))
+		}
+		i = j + 1
+	}
+	return result
+}
@@ -0,0 +1,489 @@
+package redistest
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// Run a command, the cluster lock held.
+func (n *Node) exec(cs *connState, args []string) interface{} {
+	cmd := strings.ToLower(args[0])
+	args = args[1:]
+
+	if cmd == "auth" {
+		return n.auth(cs, args)
+	}
+	if !cs.authed {
+		return replyError("NOAUTH Authentication required.")
+	}
+	n.commands = append(n.commands, append([]string{cmd}, args...))
+	if n.disabled[cmd] || (len(args) > 0 && n.disabled[cmd+" "+strings.ToLower(args[0])]) {
+		return errorf("ERR command '%s' disabled on this node", cmd)
+	}
+
+	asking := cs.asking
+	cs.asking = false
+
+	switch cmd {
+	case "ping":
+		if len(args) > 0 {
+			return args[0]
+		}
+		return status("PONG")
+	case "echo":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		return args[0]
+	case "quit":
+		cs.quit = true
+		return status("OK")
+	case "select":
+		if len(args) != 1 || args[0] != "0" {
+			return replyError("ERR DB index is out of range")
+		}
+		return status("OK")
+	case "asking":
+		cs.asking = true
+		return status("OK")
+	case "readonly", "readwrite":
+		return status("OK")
+	case "shutdown":
+		n.stop()
+		return nil
+	case "info":
+		return n.info(args)
+	case "config":
+		return n.configCmd(args)
+	case "cluster":
+		if !n.clusterEnabled {
+			return replyError("ERR This instance has cluster support disabled")
+		}
+		return n.clusterCmd(args)
+	case "dbsize":
+		return len(n.data())
+	case "flushall", "flushdb":
+		if n.master != nil {
+			return replyError("READONLY You can't write against a read only replica.")
+		}
+		n.write(func(keys map[string]string) {
+			for k := range keys {
+				delete(keys, k)
+			}
+		})
+		return status("OK")
+	case "keys":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		return matchKeys(n.data(), args[0])
+	case "scan":
+		return n.scan(args)
+	case "get", "exists", "set", "del":
+		return n.keyCmd(cmd, args, asking)
+	case "migrate":
+		return n.migrate(args)
+	case "memory":
+		return n.memoryCmd(args, asking)
+	}
+	return errorf("ERR unknown command '%s'", cmd)
+}
+
+func wrongArgs(cmd string) replyError {
+	return errorf("ERR wrong number of arguments for '%s' command", cmd)
+}
+
+// AUTH [user] password
+func (n *Node) auth(cs *connState, args []string) interface{} {
+	var user, password string
+	switch len(args) {
+	case 1:
+		user, password = "default", args[0]
+	case 2:
+		user, password = args[0], args[1]
+	default:
+		return wrongArgs("auth")
+	}
+
+	if n.password == "" && len(args) == 1 {
+		return replyError("ERR AUTH <password> called without any password configured for the default user.")
+	}
+	wantUser := n.user
+	if wantUser == "" {
+		wantUser = "default"
+	}
+	if user != wantUser || password != n.password {
+		return replyError("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	cs.authed = true
+	return status("OK")
+}
+
+// Check the key is served by the node, the way a cluster node redirects
+// the clients.
+func (n *Node) checkKey(key string, asking bool) interface{} {
+	if !n.clusterEnabled {
+		return nil
+	}
+
+	slot := int(redistrib.Key2Slot(key))
+	owner := n.cluster.slots[slot]
+	if owner == nil {
+		return replyError("CLUSTERDOWN Hash slot not served")
+	}
+	if owner == n {
+		if target, ok := n.migrating[slot]; ok {
+			if _, exists := n.keys[key]; !exists {
+				return errorf("ASK %d %s", slot, target.addr)
+			}
+		}
+		return nil
+	}
+	if _, ok := n.importing[slot]; ok && asking {
+		return nil
+	}
+	return errorf("MOVED %d %s", slot, owner.addr)
+}
+
+func (n *Node) keyCmd(cmd string, args []string, asking bool) interface{} {
+	if len(args) == 0 || (cmd == "get" && len(args) != 1) || (cmd == "set" && len(args) != 2) {
+		return wrongArgs(cmd)
+	}
+	for _, key := range args[:1] {
+		if err := n.checkKey(key, asking); err != nil {
+			return err
+		}
+	}
+	if n.master != nil && (cmd == "set" || cmd == "del") {
+		return errorf("MOVED %d %s", redistrib.Key2Slot(args[0]), n.master.addr)
+	}
+
+	keys := n.data()
+	switch cmd {
+	case "get":
+		if value, ok := keys[args[0]]; ok {
+			return value
+		}
+		return nil
+	case "set":
+		n.write(func(keys map[string]string) {
+			keys[args[0]] = args[1]
+		})
+		return status("OK")
+	}
+
+	count := 0
+	for _, key := range args {
+		if _, ok := keys[key]; ok {
+			count++
+		}
+	}
+	if cmd == "del" {
+		n.write(func(keys map[string]string) {
+			for _, key := range args {
+				delete(keys, key)
+			}
+		})
+	}
+	return count
+}
+
+// MEMORY USAGE key, the key and value lengths plus a fixed overhead.
+func (n *Node) memoryCmd(args []string, asking bool) interface{} {
+	if len(args) < 2 || strings.ToLower(args[0]) != "usage" {
+		return errorf("ERR unknown subcommand '%s'", strings.Join(args, " "))
+	}
+	if err := n.checkKey(args[1], asking); err != nil {
+		return err
+	}
+	value, ok := n.data()[args[1]]
+	if !ok {
+		return nil
+	}
+	return len(args[1]) + len(value) + 48
+}
+
+func matchKeys(keys map[string]string, pattern string) []string {
+	var matched []string
+	for _, key := range sortedKeys(keys) {
+		if ok, _ := path.Match(pattern, key); ok {
+			matched = append(matched, key)
+		}
+	}
+	return matched
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count], the cursor is the index of
+// the next key in sorted order.
+func (n *Node) scan(args []string) interface{} {
+	if len(args) == 0 {
+		return wrongArgs("scan")
+	}
+	cursor, err := strconv.Atoi(args[0])
+	if err != nil || cursor < 0 {
+		return replyError("ERR invalid cursor")
+	}
+
+	pattern, count := "*", 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return replyError("ERR syntax error")
+		}
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(args[i+1]); err != nil || count < 1 {
+				return replyError("ERR syntax error")
+			}
+		default:
+			return replyError("ERR syntax error")
+		}
+	}
+
+	keys := sortedKeys(n.data())
+	var batch []string
+	for ; cursor < len(keys) && len(batch) < count; cursor++ {
+		if ok, _ := path.Match(pattern, keys[cursor]); ok {
+			batch = append(batch, keys[cursor])
+		}
+	}
+	if cursor >= len(keys) {
+		cursor = 0
+	}
+	if batch == nil {
+		batch = []string{}
+	}
+	return []interface{}{strconv.Itoa(cursor), batch}
+}
+
+// MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password] [AUTH2 username password] [KEYS key ...]
+//
+// The keys are moved in process to the node listening on host:port.
+func (n *Node) migrate(args []string) interface{} {
+	if len(args) < 5 {
+		return wrongArgs("migrate")
+	}
+
+	var keys []string
+	keep, replace := false, false
+	user, password := "", ""
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "copy":
+			keep = true
+		case "replace":
+			replace = true
+		case "auth":
+			if i+1 >= len(args) {
+				return replyError("ERR syntax error")
+			}
+			password = args[i+1]
+			i++
+		case "auth2":
+			if i+2 >= len(args) {
+				return replyError("ERR syntax error")
+			}
+			user, password = args[i+1], args[i+2]
+			i += 2
+		case "keys":
+			if args[2] != "" {
+				return replyError("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			keys = args[i+1:]
+			i = len(args)
+		default:
+			return replyError("ERR syntax error")
+		}
+	}
+	if keys == nil {
+		keys = []string{args[2]}
+	}
+	if args[3] != "0" {
+		return replyError("ERR Target instance replied with error: ERR DB index is out of range")
+	}
+
+	target := n.cluster.nodeByAddr(net.JoinHostPort(args[0], args[1]))
+	if target == nil || target.down {
+		return errorf("IOERR error or timeout connecting to the client")
+	}
+	if target.password != "" {
+		if user == "" {
+			user = "default"
+		}
+		wantUser := target.user
+		if wantUser == "" {
+			wantUser = "default"
+		}
+		if user != wantUser || password != target.password {
+			return replyError("ERR Target instance replied with error: WRONGPASS invalid username-password pair or user is disabled.")
+		}
+	}
+
+	source := n.data()
+	var moved []string
+	for _, key := range keys {
+		if _, ok := source[key]; !ok {
+			continue
+		}
+		if _, ok := target.data()[key]; ok && !replace {
+			return replyError("ERR Target instance replied with error: BUSYKEY Target key name already exists.")
+		}
+		moved = append(moved, key)
+	}
+	if len(moved) == 0 {
+		return status("NOKEY")
+	}
+
+	target.write(func(keys map[string]string) {
+		for _, key := range moved {
+			keys[key] = source[key]
+		}
+	})
+	if !keep {
+		n.write(func(keys map[string]string) {
+			for _, key := range moved {
+				delete(keys, key)
+			}
+		})
+	}
+	return status("OK")
+}
+
+// INFO [section], the sections are the ones the tool reads.
+func (n *Node) info(args []string) interface{} {
+	section := "default"
+	if len(args) > 0 {
+		section = strings.ToLower(args[0])
+	}
+	all := section == "default" || section == "all" || section == "everything"
+
+	var b strings.Builder
+	add := func(name string, lines ...string) {
+		if !all && section != strings.ToLower(name) {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", name)
+		for _, line := range lines {
+			b.WriteString(line + "\r\n")
+		}
+	}
+
+	add("Server",
+		"redis_version:7.0.0",
+		"redis_mode:"+map[bool]string{true: "cluster", false: "standalone"}[n.clusterEnabled],
+		fmt.Sprintf("tcp_port:%d", n.Port()),
+		"run_id:"+n.id)
+
+	used := 1024
+	for k, v := range n.data() {
+		used += len(k) + len(v)
+	}
+	add("Memory",
+		fmt.Sprintf("used_memory:%d", used),
+		"total_system_memory:17179869184",
+		"maxmemory:"+n.config["maxmemory"],
+		"maxmemory_policy:"+n.config["maxmemory-policy"])
+
+	add("Replication", n.replicationInfo()...)
+
+	add("Cluster", "cluster_enabled:"+map[bool]string{true: "1", false: "0"}[n.clusterEnabled])
+
+	var keyspace []string
+	if keys := len(n.data()); keys > 0 {
+		keyspace = append(keyspace, fmt.Sprintf("db0:keys=%d,expires=0,avg_ttl=0", keys))
+	}
+	add("Keyspace", keyspace...)
+
+	return b.String()
+}
+
+func (n *Node) replicationInfo() []string {
+	if n.master != nil {
+		host, port, _ := net.SplitHostPort(n.master.addr)
+		link := "up"
+		if n.master.down {
+			link = "down"
+		}
+		return []string{
+			"role:slave",
+			"master_host:" + host,
+			"master_port:" + port,
+			"master_link_status:" + link,
+			fmt.Sprintf("slave_repl_offset:%d", n.masterOffset()-n.lag),
+			fmt.Sprintf("master_repl_offset:%d", n.masterOffset()-n.lag),
+		}
+	}
+
+	lines := []string{"role:master"}
+	var replicas []string
+	for _, r := range n.cluster.nodes {
+		if r.master == n && !r.down {
+			host, port, _ := net.SplitHostPort(r.addr)
+			replicas = append(replicas, fmt.Sprintf("slave%d:ip=%s,port=%s,state=online,offset=%d,lag=0",
+				len(replicas), host, port, n.offset-r.lag))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("connected_slaves:%d", len(replicas)))
+	lines = append(lines, replicas...)
+	return append(lines, fmt.Sprintf("master_repl_offset:%d", n.offset))
+}
+
+// Replication offset of the master a replica follows.
+func (n *Node) masterOffset() int {
+	m := n
+	for m.master != nil {
+		m = m.master
+	}
+	return m.offset
+}
+
+// CONFIG GET pattern | SET parameter value | REWRITE | RESETSTAT
+func (n *Node) configCmd(args []string) interface{} {
+	if len(args) == 0 {
+		return wrongArgs("config")
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "get":
+		if len(args) != 2 {
+			return wrongArgs("config|get")
+		}
+		params := make([]string, 0, len(n.config))
+		for p := range n.config {
+			params = append(params, p)
+		}
+		sort.Strings(params)
+
+		reply := []string{}
+		for _, p := range params {
+			if ok, _ := path.Match(strings.ToLower(args[1]), p); ok {
+				reply = append(reply, p, n.config[p])
+			}
+		}
+		return reply
+	case "set":
+		if len(args) != 3 {
+			return wrongArgs("config|set")
+		}
+		param := strings.ToLower(args[1])
+		if _, ok := n.config[param]; !ok {
+			return errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[1])
+		}
+		n.config[param] = args[2]
+		return status("OK")
+	case "rewrite", "resetstat":
+		return status("OK")
+	}
+	return errorf("ERR Unknown subcommand or wrong number of arguments for '%s'", args[0])
+}
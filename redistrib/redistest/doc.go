@@ -0,0 +1,30 @@
+// Package redistest runs fake Redis Cluster nodes in process, so the
+// cluster operations of redistrib and of the redis-trib commands can be
+// exercised end to end without redis-server binaries.
+//
+// The nodes speak RESP on loopback ports and implement the subset of
+// commands the tool relies on: CLUSTER NODES, INFO, MYID, KEYSLOT,
+// ADDSLOTS, DELSLOTS, SETSLOT, MEET, REPLICATE, FORGET, BUMPEPOCH,
+// SET-CONFIG-EPOCH, COUNTKEYSINSLOT and GETKEYSINSLOT, FAILOVER, MIGRATE,
+// SCAN, KEYS, INFO, CONFIG, DBSIZE, MEMORY USAGE, SHUTDOWN and a string
+// keyspace with GET, SET, DEL and EXISTS. The nodes share one slot table,
+// gossip is immediate, and a replica serves the keyspace of its master.
+// ListenTLS adds a TLS port to the nodes, with certificates generated by
+// NewCerts.
+//
+//	c, err := redistest.NewCluster(6)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer c.Close()
+//	if err := c.Bootstrap(1); err != nil {
+//		t.Fatal(err)
+//	}
+//	c.Nodes()[0].Set("foo", "bar")
+//
+//	rt := redistrib.NewRedisTrib()
+//	rt.SetDialer(c.Dialer()) // optional, skips TCP
+//	if err := rt.LoadCluster(c.Addrs()[0]); err != nil {
+//		t.Fatal(err)
+//	}
+package redistest
@@ -0,0 +1,111 @@
+package redistest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+// Certs are a CA and a certificate it signed for 127.0.0.1 and
+// localhost, written as PEM files. The nodes and the clients can both use
+// the certificate.
+type Certs struct {
+	// Paths of the PEM files.
+	CACert string
+	Cert   string
+	Key    string
+
+	pool *x509.CertPool
+	pair tls.Certificate
+}
+
+// Generate the certificates in dir.
+func NewCerts(dir string) (*Certs, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redistest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	if ca, err = x509.ParseCertificate(caDER); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "redistest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Certs{
+		CACert: filepath.Join(dir, "ca.crt"),
+		Cert:   filepath.Join(dir, "redis.crt"),
+		Key:    filepath.Join(dir, "redis.key"),
+		pool:   x509.NewCertPool(),
+	}
+	c.pool.AddCert(ca)
+	files := []struct {
+		path  string
+		block *pem.Block
+	}{
+		{c.CACert, &pem.Block{Type: "CERTIFICATE", Bytes: caDER}},
+		{c.Cert, &pem.Block{Type: "CERTIFICATE", Bytes: leafDER}},
+		{c.Key, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(f.path, pem.EncodeToMemory(f.block), 0600); err != nil {
+			return nil, err
+		}
+	}
+	if c.pair, err = tls.LoadX509KeyPair(c.Cert, c.Key); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Config of the nodes for ListenTLS. The clients must present a
+// certificate signed by the CA, like with tls-auth-clients yes.
+func (c *Certs) ServerConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.pair},
+		ClientCAs:    c.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
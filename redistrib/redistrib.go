@@ -1,4 +1,4 @@
-package main
+package redistrib
 
 import (
 	"errors"
@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -26,20 +27,55 @@ const (
 type RedisTrib struct {
 	nodes       [](*ClusterNode)
 	fix         bool
-	errors      []error
+	problems    []*Problem
 	timeout     int
 	replicasNum int // used for create command -replicas
+	dialer      Dialer
+	dryRun      *DryRun
+	workers     int // connections opened at once by the discovery
+	unreachable []*UnreachableNode
+	confirm     func(msg string) error
 }
 
+// A node of the cluster the discovery could not load.
+type UnreachableNode struct {
+	Addr string
+	Err  error
+}
+
+// Number of nodes dialed at once by LoadClusterInfoFromNode.
+const DefaultDiscoveryWorkers = 16
+
 func NewRedisTrib() (rt *RedisTrib) {
 	rt = &RedisTrib{
 		fix:     false,
 		timeout: MigrateDefaultTimeout,
+		dialer:  DefaultDialer,
+		workers: DefaultDiscoveryWorkers,
 	}
 
 	return rt
 }
 
+func (self *RedisTrib) Dialer() Dialer {
+	return self.dialer
+}
+
+// Set the dialer of the nodes created from now on.
+func (self *RedisTrib) SetDialer(dialer Dialer) {
+	self.dialer = dialer
+}
+
+// Create a node connected with the dialer of the cluster manager.
+func (self *RedisTrib) NewNode(addr string) (*ClusterNode, error) {
+	node, err := NewClusterNode(addr)
+	if err != nil {
+		return nil, err
+	}
+	node.SetDialer(self.dialer)
+	return node, nil
+}
+
 func (self *RedisTrib) AddNode(node *ClusterNode) {
 	self.nodes = append(self.nodes, node)
 }
@@ -50,19 +86,70 @@ func (self *RedisTrib) Nodes() [](*ClusterNode) {
 
 func (self *RedisTrib) ResetNodes() {
 	self.nodes = []*ClusterNode{}
+	self.unreachable = nil
+}
+
+// Set the number of nodes dialed at once by the discovery, 1 loads them
+// one after another.
+func (self *RedisTrib) SetWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	self.workers = workers
+}
+
+// The nodes the last discovery could not load, in the order of the
+// CLUSTER NODES output.
+func (self *RedisTrib) Unreachable() []*UnreachableNode {
+	return self.unreachable
 }
 
 func (self *RedisTrib) SetFix(fix bool) {
 	self.fix = fix
 }
 
-func (self *RedisTrib) ClusterError(err string) {
-	self.errors = append(self.errors, errors.New(err))
-	logrus.Errorf(err)
+// Set the function asked before each kind of fix of the slots coverage.
+// It returns an error, of kind ErrAborted by convention, to leave the
+// slots as they are. Without one the fixes are made as SetFix asked.
+func (self *RedisTrib) SetConfirm(confirm func(msg string) error) {
+	self.confirm = confirm
+}
+
+func (self *RedisTrib) confirmFix(msg string) error {
+	if self.confirm == nil {
+		return nil
+	}
+	return self.confirm(msg)
+}
+
+// Record a problem found in the cluster.
+func (self *RedisTrib) ClusterError(p *Problem) {
+	self.problems = append(self.problems, p)
+	logrus.Error(p.Message)
+}
+
+func (self *RedisTrib) Problems() []*Problem {
+	return self.problems
+}
+
+// The problems making the cluster unsafe to reshard, all of them but the
+// replica placement ones.
+func (self *RedisTrib) SlotsProblems() []*Problem {
+	var problems []*Problem
+	for _, p := range self.problems {
+		if !placementProblems[p.Category] {
+			problems = append(problems, p)
+		}
+	}
+	return problems
 }
 
 func (self *RedisTrib) Errors() []error {
-	return self.errors
+	errs := make([]error, 0, len(self.problems))
+	for _, p := range self.problems {
+		errs = append(errs, p)
+	}
+	return errs
 }
 
 func (self *RedisTrib) Timeout() int {
@@ -95,12 +182,11 @@ func (self *RedisTrib) GetNodeByName(name string) (node *ClusterNode) {
 // part of the node ID as long as the prefix in unique across the
 // cluster.
 func (self *RedisTrib) GetNodeByAbbreviatedName(name string) (n *ClusterNode) {
-	length := len(name)
 	var candidates = []*ClusterNode{}
 
 	name = strings.ToLower(name)
 	for _, node := range self.Nodes() {
-		if node.Name()[0:length] == name {
+		if strings.HasPrefix(node.Name(), name) {
 			candidates = append(candidates, node)
 		}
 	}
@@ -138,7 +224,10 @@ func (self *RedisTrib) GetMasterWithLeastReplicas() (node *ClusterNode) {
 	return mnodes[j]
 }
 
-func (self *RedisTrib) CheckCluster(quiet bool) {
+// Check the loaded cluster, the problems found are collected in Errors.
+// In fix mode they are fixed too, and the error returned is the one that
+// prevented the fix.
+func (self *RedisTrib) CheckCluster(quiet bool) error {
 	logrus.Printf(">>> Performing Cluster Check (using node %s).", self.Nodes()[0].String())
 
 	if !quiet {
@@ -146,8 +235,14 @@ func (self *RedisTrib) CheckCluster(quiet bool) {
 	}
 
 	self.CheckConfigConsistency()
-	self.CheckOpenSlots()
-	self.CheckSlotsCoverage()
+	self.CheckFailedMasters()
+	if err := self.CheckOpenSlots(); err != nil {
+		return err
+	}
+	if err := self.CheckSlotsCoverage(); err != nil {
+		return err
+	}
+	return self.CheckReplicas()
 }
 
 func (self *RedisTrib) ShowClusterInfo() {
@@ -194,12 +289,41 @@ func (self *RedisTrib) AssignConfigEpoch() {
 
 func (self *RedisTrib) CheckConfigConsistency() {
 	if !self.isConfigConsistent() {
-		self.ClusterError("Nodes don't agree about configuration!")
+		self.ClusterError(&Problem{
+			Category: ProblemConfigInconsistent,
+			Message:  "Nodes don't agree about configuration!",
+		})
 	} else {
 		logrus.Printf("[OK] All nodes agree about slots configuration.")
 	}
 }
 
+// Check for the masters flagged as failing by the cluster, they are not
+// loaded so they are found among the friends of the loaded nodes.
+func (self *RedisTrib) CheckFailedMasters() {
+	failed := make(map[string]bool)
+	for _, node := range self.Nodes() {
+		for _, friend := range node.Friends() {
+			if failed[friend.Name()] || !friend.HasFlag("master") {
+				continue
+			}
+			for _, flag := range friend.Flags() {
+				if flag == "fail" {
+					failed[friend.Name()] = true
+					self.ClusterError(&Problem{
+						Category: ProblemFailedMaster,
+						Node:     friend.String(),
+						Message:  fmt.Sprintf("Master %s (%s) is failing.", friend.String(), friend.Name()),
+					})
+				}
+			}
+		}
+	}
+	if len(failed) == 0 {
+		logrus.Printf("[OK] No failing master.")
+	}
+}
+
 func (self *RedisTrib) isConfigConsistent() bool {
 	clean := true
 	oldSig := ""
@@ -221,6 +345,10 @@ func (self *RedisTrib) isConfigConsistent() bool {
 
 func (self *RedisTrib) WaitClusterJoin() bool {
 	logrus.Printf("Waiting for the cluster to join")
+	if self.dryRun != nil {
+		// the nodes were not told to meet
+		return true
+	}
 
 	for {
 		if !self.isConfigConsistent() {
@@ -257,12 +385,12 @@ func (self *RedisTrib) GetNodeWithMostKeysInSlot(nodes []*ClusterNode, slot int)
 // Slot 'slot' was found to be in importing or migrating state in one or
 // more nodes. This function fixes this condition by migrating keys where
 // it seems more sensible.
-func (self *RedisTrib) FixOpenSlot(slot string) {
+func (self *RedisTrib) FixOpenSlot(slot string) error {
 	logrus.Printf(">>> Fixing open slot %s", slot)
 
 	slotnum, err := strconv.Atoi(slot)
 	if err != nil {
-		logrus.Warnf("Bad slot num: \"%s\" for FixOpenSlot!", slot)
+		return NewError(ErrBadArgument, "", err, "Bad slot num: \"%s\" for FixOpenSlot!", slot)
 	}
 
 	// Try to obtain the current slot owner, according to the current
@@ -285,7 +413,6 @@ func (self *RedisTrib) FixOpenSlot(slot string) {
 		} else if _, ok := node.Importing()[slotnum]; ok {
 			importing = append(importing, node)
 		} else {
-			// TODO: fix countkeysinslot
 			num, _ := node.ClusterCountKeysInSlot(slotnum)
 			if num > 0 && node != owner {
 				logrus.Printf("*** Found keys about slot %s in node %s!", slot, node.String())
@@ -304,13 +431,12 @@ func (self *RedisTrib) FixOpenSlot(slot string) {
 
 		// If we still don't have an owner, we can't fix it.
 		if owner == nil {
-			logrus.Fatalf("[ERR] Can't select a slot owner. Impossible to fix.")
+			return NewError(ErrSlotConflict, "", nil, "[ERR] Can't select a slot owner for slot %d. Impossible to fix.", slotnum)
 		}
 
-		// TODO: add fix open slot code here
 		// Use ADDSLOTS to assign the slot.
 		logrus.Printf("*** Configuring %s as the slot owner", owner.String())
-		owner.ClusterSetSlot(slotnum, "stable")
+		owner.ClusterSetSlot(slotnum, "stable", "")
 		owner.ClusterAddSlots(slotnum)
 		// Make sure this information will propagate. Not strictly needed
 		// since there is no past owner, so all the other nodes will accept
@@ -319,8 +445,8 @@ func (self *RedisTrib) FixOpenSlot(slot string) {
 
 		// Remove the owner from the list of migrating/importing
 		// nodes.
-		//migrating.delete(owner)
-		//importing.delete(owner)
+		migrating = removeClusterNode(migrating, owner)
+		importing = removeClusterNode(importing, owner)
 	}
 
 	// If there are multiple owners of the slot, we need to fix it
@@ -339,12 +465,55 @@ func (self *RedisTrib) FixOpenSlot(slot string) {
 			}
 
 			node.ClusterDelSlots(slotnum)
-			//n.r.cluster('setslot',slot,'importing',owner.info[:name])
-			//importing.delete(n) # Avoid duplciates
-			//importing << n
+			node.ClusterSetSlot(slotnum, "importing", owner.Name())
+			// Avoid duplicates
+			importing = removeClusterNode(importing, node)
+			importing = append(importing, node)
 		}
 		owner.ClusterBumpepoch()
 	}
+
+	if len(migrating) == 1 && len(importing) == 1 {
+		// Case 1: The slot is in migrating state in one slot, and in
+		//         importing state in 1 slot. That's trivial to address.
+		err = self.MoveSlot(&MovedNode{Source: migrating[0], Slot: slotnum}, importing[0],
+			&MoveOpts{Dots: true, Fix: true})
+	} else if len(migrating) == 0 && len(importing) > 0 {
+		// Case 2: There are multiple nodes that claim the slot as importing,
+		// they probably got keys about the slot after a restart so opened
+		// the slot. In this case we just move all the keys to the owner
+		// according to the configuration.
+		logrus.Printf(">>> Moving all the %d slot keys to its owner %s", slotnum, owner.String())
+		for _, node := range importing {
+			if node == owner {
+				continue
+			}
+			err = self.MoveSlot(&MovedNode{Source: node, Slot: slotnum}, owner,
+				&MoveOpts{Dots: true, Fix: true, Cold: true})
+			if err != nil {
+				break
+			}
+			logrus.Printf(">>> Setting %d as STABLE in %s", slotnum, node.String())
+			node.ClusterSetSlot(slotnum, "stable", "")
+		}
+	} else if len(importing) == 0 && len(migrating) == 1 {
+		// Case 3: There are no slots claiming to be in importing state, but
+		// there is a migrating node that actually don't have any key. We
+		// can just close the slot, probably a reshard interrupted in the middle.
+		keys, e := migrating[0].ClusterGetKeysInSlot(slotnum, 10)
+		if e == nil && len(keys) == 0 {
+			_, err = migrating[0].ClusterSetSlot(slotnum, "stable", "")
+		} else {
+			err = NewError(ErrSlotConflict, migrating[0].String(), e,
+				"[ERR] Sorry, can't fix slot %d: the node is migrating it but still has keys", slotnum)
+		}
+	} else {
+		err = NewError(ErrSlotConflict, "", nil, "[ERR] Sorry, Redis-trib can't fix this slot yet (work in progress). "+
+			"Slot %d is set as migrating in %s, importing in %s, owner is %s", slotnum,
+			ClusterNodeArray2String(migrating), ClusterNodeArray2String(importing), owner.String())
+	}
+
+	return err
 }
 
 // Merge slots of every known node. If the resulting slots are equal
@@ -365,7 +534,7 @@ func (self *RedisTrib) NotCoveredSlots() []int {
 	slots := []int{}
 	coveredSlots := self.CoveredSlots()
 
-	for index <= ClusterHashSlots {
+	for ; index < ClusterHashSlots; index++ {
 		if _, ok := coveredSlots[index]; !ok {
 			slots = append(slots, index)
 		}
@@ -373,42 +542,51 @@ func (self *RedisTrib) NotCoveredSlots() []int {
 	return slots
 }
 
-func (self *RedisTrib) CheckSlotsCoverage() {
+func (self *RedisTrib) CheckSlotsCoverage() error {
 	logrus.Printf(">>> Check slots coverage...")
 	slots := self.CoveredSlots()
 	// add check open slots code.
 	if len(slots) == ClusterHashSlots {
 		logrus.Printf("[OK] All %d slots covered.", ClusterHashSlots)
 	} else {
-		self.ClusterError(fmt.Sprintf("Not all %d slots are covered by nodes.", ClusterHashSlots))
+		self.ClusterError(&Problem{
+			Category: ProblemUncoveredSlot,
+			Slots:    SlotRanges(self.NotCoveredSlots()),
+			Message:  fmt.Sprintf("Not all %d slots are covered by nodes.", ClusterHashSlots),
+		})
 		if self.fix {
-			self.FixSlotsCoverage()
+			return self.FixSlotsCoverage()
 		}
 	}
+	return nil
 }
 
-func (self *RedisTrib) CheckOpenSlots() {
+func (self *RedisTrib) CheckOpenSlots() error {
 	logrus.Printf(">>> Check for open slots...")
 	// add check open slots code.
 	var openSlots []string
 
 	for _, node := range self.Nodes() {
 		if len(node.Migrating()) > 0 {
-			keys := make([]string, len(node.Migrating()))
-			for k, _ := range node.Migrating() {
-				keys = append(keys, strconv.Itoa(k))
-			}
-			self.ClusterError(fmt.Sprintf("Node %s has slots in migrating state (%s).",
-				node.String(), strings.Join(keys, ",")))
+			slots, keys := openSlotsOf(node.Migrating())
+			self.ClusterError(&Problem{
+				Category: ProblemOpenSlot,
+				Node:     node.String(),
+				Slots:    SlotRanges(slots),
+				Message: fmt.Sprintf("Node %s has slots in migrating state (%s).",
+					node.String(), strings.Join(keys, ",")),
+			})
 			openSlots = append(openSlots, keys...)
 		}
 		if len(node.Importing()) > 0 {
-			keys := make([]string, len(node.Importing()))
-			for k, _ := range node.Importing() {
-				keys = append(keys, strconv.Itoa(k))
-			}
-			self.ClusterError(fmt.Sprintf("Node %s has slots in importing state (%s).",
-				node.String(), strings.Join(keys, ",")))
+			slots, keys := openSlotsOf(node.Importing())
+			self.ClusterError(&Problem{
+				Category: ProblemOpenSlot,
+				Node:     node.String(),
+				Slots:    SlotRanges(slots),
+				Message: fmt.Sprintf("Node %s has slots in importing state (%s).",
+					node.String(), strings.Join(keys, ",")),
+			})
 			openSlots = append(openSlots, keys...)
 		}
 	}
@@ -418,9 +596,28 @@ func (self *RedisTrib) CheckOpenSlots() {
 	}
 	if self.fix {
 		for _, slot := range uniq {
-			self.FixOpenSlot(slot)
+			if err := self.FixOpenSlot(slot); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
+
+// The sorted slots of a migrating or importing map, as numbers and as
+// strings.
+func openSlotsOf(m map[int]string) ([]int, []string) {
+	slots := make([]int, 0, len(m))
+	for slot := range m {
+		slots = append(slots, slot)
+	}
+	sort.Ints(slots)
+
+	keys := make([]string, 0, len(slots))
+	for _, slot := range slots {
+		keys = append(keys, strconv.Itoa(slot))
+	}
+	return slots, keys
 }
 
 func (self *RedisTrib) NodesWithKeysInSlot(slot int) (nodes [](*ClusterNode)) {
@@ -437,7 +634,7 @@ func (self *RedisTrib) NodesWithKeysInSlot(slot int) (nodes [](*ClusterNode)) {
 	return nodes
 }
 
-func (self *RedisTrib) FixSlotsCoverage() {
+func (self *RedisTrib) FixSlotsCoverage() error {
 	notCovered := self.NotCoveredSlots()
 
 	logrus.Printf(">>> Fixing slots coverage...")
@@ -475,11 +672,16 @@ func (self *RedisTrib) FixSlotsCoverage() {
 	if len(none) > 0 {
 		result := NumArray2String(none)
 		logrus.Printf("The folowing uncovered slots have no keys across the cluster: %s", result)
-		YesOrDie("Fix these slots by covering with a random node?")
+		if err := self.confirmFix("Fix these slots by covering with a random node?"); err != nil {
+			return err
+		}
 		for _, slot := range none {
-			node := self.Nodes()[rand.Intn(len(self.Nodes()))]
+			masters := self.Masters()
+			node := masters[rand.Intn(len(masters))]
 			logrus.Printf(">>> Covering slot %d with %s.", slot, node.String())
-			node.ClusterAddSlots(slot)
+			if _, err := node.ClusterAddSlots(slot); err != nil {
+				return NewError(ErrSlotConflict, node.String(), err, "Covering slot %d failed", slot)
+			}
 		}
 	}
 
@@ -487,11 +689,15 @@ func (self *RedisTrib) FixSlotsCoverage() {
 	if len(single) > 0 {
 		result := NumArray2String(single)
 		logrus.Printf("The folowing uncovered slots have keys in just one node: %s", result)
-		YesOrDie("Fix these slots by covering with those nodes?")
+		if err := self.confirmFix("Fix these slots by covering with those nodes?"); err != nil {
+			return err
+		}
 		for _, slot := range single {
 			node := slots[slot][0]
 			logrus.Printf(">>> Covering slot %d with %s", slot, node.String())
-			node.ClusterAddSlots(slot)
+			if _, err := node.ClusterAddSlots(slot); err != nil {
+				return NewError(ErrSlotConflict, node.String(), err, "Covering slot %d failed", slot)
+			}
 		}
 	}
 
@@ -499,30 +705,36 @@ func (self *RedisTrib) FixSlotsCoverage() {
 	if len(multi) > 0 {
 		result := NumArray2String(multi)
 		logrus.Printf("The folowing uncovered slots have keys in multiple nodes: %s", result)
-		YesOrDie("Fix these slots by moving keys into a single node?")
+		if err := self.confirmFix("Fix these slots by moving keys into a single node?"); err != nil {
+			return err
+		}
 		for _, slot := range multi {
 			target := self.GetNodeWithMostKeysInSlot(slots[slot], slot)
 			if target != nil {
 				logrus.Printf(">>> Covering slot %d moving keys to %s", slot, target.String())
 				target.ClusterAddSlots(slot)
-				target.ClusterSetSlot(slot, "stable")
+				target.ClusterSetSlot(slot, "stable", "")
 				nodes := slots[slot]
 				for _, src := range nodes {
 					if src == target {
 						continue
 					}
 
-					// TODO:
 					// Set the source node in 'importing' state (even if we will
 					// actually migrate keys away) in order to avoid receiving
 					// redirections for MIGRATE.
-					src.ClusterSetSlot(slot, "importing")
-					//move_slot(src,target,slot,:dots=>true,:fix=>true,:cold=>true)
-					src.ClusterAddSlots(slot)
+					src.ClusterSetSlot(slot, "importing", target.Name())
+					err := self.MoveSlot(&MovedNode{Source: src, Slot: slot}, target,
+						&MoveOpts{Dots: true, Fix: true, Cold: true})
+					if err != nil {
+						return err
+					}
+					src.ClusterSetSlot(slot, "stable", "")
 				}
 			}
 		}
 	}
+	return nil
 }
 
 // Return the owner of the specified slot
@@ -540,38 +752,111 @@ func (self *RedisTrib) GetSlotOwners(slot int) [](*ClusterNode) {
 	return owners
 }
 
+// Load the cluster topology from the first reachable node among seeds.
+func (self *RedisTrib) LoadCluster(seeds ...string) error {
+	err := errors.New("no seed node given")
+	for _, addr := range seeds {
+		self.ResetNodes()
+		if err = self.LoadClusterInfoFromNode(addr); err == nil {
+			return nil
+		}
+		logrus.Warnf("*** Load cluster from %s failed: %s", addr, err)
+	}
+	return err
+}
+
+// Return the master nodes of the loaded cluster.
+func (self *RedisTrib) Masters() [](*ClusterNode) {
+	var masters [](*ClusterNode)
+	for _, node := range self.Nodes() {
+		if node.HasFlag("master") {
+			masters = append(masters, node)
+		}
+	}
+	return masters
+}
+
 // Load cluster info from a cluster node.
 func (self *RedisTrib) LoadClusterInfoFromNode(addr string) error {
-	node := NewClusterNode(addr)
+	node, err := self.NewNode(addr)
+	if err != nil {
+		return err
+	}
 
-	node.Connect(true)
+	if err := node.Connect(); err != nil {
+		return err
+	}
 	if !node.AssertCluster() {
-		logrus.Fatalf("Node %s is not configured as a cluster node.", node.String())
+		return NewError(ErrNotClusterNode, node.String(), nil, "Node is not configured as a cluster node.")
 	}
 	if err := node.LoadInfo(true); err != nil {
-		return fmt.Errorf("load info from node %s failed", node)
+		return NewError(ErrConnection, node.String(), err, "Load info from node failed")
 	}
 	self.AddNode(node)
 
-	for _, n := range node.Friends() {
-		if n.HasFlag("noaddr") || n.HasFlag("disconnected") || n.HasFlag("fail") {
-			continue
+	// Dial the friends in parallel, the nodes are added in the order of
+	// the CLUSTER NODES output.
+	friends := node.Friends()
+	loaded := make([]*ClusterNode, len(friends))
+	errs := make([]error, len(friends))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < self.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				loaded[i], errs[i] = self.loadFriend(friends[i])
+			}
+		}()
+	}
+	for i := range friends {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i, n := range friends {
+		if errs[i] != nil {
+			self.unreachable = append(self.unreachable, &UnreachableNode{Addr: n.String(), Err: errs[i]})
+		} else if loaded[i] != nil {
+			self.AddNode(loaded[i])
 		}
-
-		fnode := NewClusterNode(n.String())
-		fnode.Connect(false)
-		if fnode.R() == nil {
-			continue
+	}
+	if len(self.unreachable) > 0 {
+		logrus.Warnf("*** %d nodes could not be reached:", len(self.unreachable))
+		for _, u := range self.unreachable {
+			logrus.Warnf("    %s: %s", u.Addr, u.Err)
 		}
-
-		fnode.LoadInfo(false)
-		self.AddNode(fnode)
 	}
 
 	self.PopulateNodesReplicasInfo()
 	return nil
 }
 
+// Connect to a friend of the first node and load its info, nil without
+// error for the friends without address.
+func (self *RedisTrib) loadFriend(n *NodeInfo) (*ClusterNode, error) {
+	if n.HasFlag("noaddr") {
+		return nil, nil
+	}
+	if n.HasFlag("disconnected") || n.HasFlag("fail") {
+		return nil, fmt.Errorf("flagged %s", strings.Join(n.Flags(), ","))
+	}
+
+	fnode, err := self.NewNode(n.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := fnode.Connect(); err != nil {
+		return nil, err
+	}
+	if err := fnode.LoadInfo(false); err != nil {
+		return nil, NewError(ErrConnection, fnode.String(), err, "Load info from node failed")
+	}
+	return fnode, nil
+}
+
 // This function is called by LoadClusterInfoFromNode in order to
 // add additional information to every node as a list of replicas.
 func (self *RedisTrib) PopulateNodesReplicasInfo() {
@@ -649,84 +934,116 @@ type MoveOpts struct {
 //  Move slots between source and target nodes using MIGRATE.
 //
 //  Options:
-//  :verbose -- Print a dot for every moved key.
+//  :dots    -- Print a dot for every moved key.
 //  :fix     -- We are moving in the context of a fix. Use REPLACE.
 //  :cold    -- Move keys without opening slots / reconfiguring the nodes.
 //  :update  -- Update nodes.info[:slots] for source/target nodes.
 //  :quiet   -- Don't print info messages.
-func (self *RedisTrib) MoveSlot(source *MovedNode, target *ClusterNode, o *MoveOpts) {
-	// TODO: add move slot code
+func (self *RedisTrib) MoveSlot(source *MovedNode, target *ClusterNode, o *MoveOpts) error {
 	if o.Pipeline <= 0 {
 		o.Pipeline = MigrateDefaultPipeline
 	}
+	src := source.Source
+	slot := source.Slot
+
+	if !o.Quiet {
+		logrus.Printf("Moving slot %d from %s to %s: ", slot, src.String(), target.String())
+	}
 
 	// We start marking the slot as importing in the destination node,
 	// and the slot as migrating in the target host. Note that the order of
 	// the operations is important, as otherwise a client may be redirected
 	// to the target node that does not yet know it is importing this slot.
-	if !o.Quiet {
-		logrus.Printf("Moving slot %d from %s to %s: ", source.Slot, source.Source.InfoString(), target.InfoString())
-	}
-
 	if !o.Cold {
-		target.ClusterSetSlot(source.Slot, "importing")
-		source.Source.ClusterSetSlot(source.Slot, "migrating")
+		if _, err := target.ClusterSetSlot(slot, "importing", src.Name()); err != nil {
+			return NewError(ErrMigrate, target.String(), err, "[ERR] Setting slot %d as importing", slot)
+		}
+		if _, err := src.ClusterSetSlot(slot, "migrating", target.Name()); err != nil {
+			return NewError(ErrMigrate, src.String(), err, "[ERR] Setting slot %d as migrating", slot)
+		}
 	}
 
 	// Migrate all the keys from source to target using the MIGRATE command
 	for {
-		keystr, err := source.Source.ClusterGetKeysInSlot(source.Slot, o.Pipeline)
-		keys := strings.Split(keystr, "\n")
-		if err == nil {
-			if len(keys) == 0 {
-				break
-			}
+		keys, err := src.ClusterGetKeysInSlot(slot, o.Pipeline)
+		if err != nil {
+			return NewError(ErrMigrate, src.String(), err, "[ERR] Getting keys of slot %d", slot)
+		}
+		if len(keys) == 0 {
+			break
+		}
 
-			// XXX: migrate parameters check
-			var cmd []interface{}
-			cmd = append(cmd, target.Host(), target.Port(), "", 0, self.Timeout(), false, true, keys)
-			_, err := source.Source.Call("migrate", cmd...)
-			// _, _ = source.Source.Call("migrate", target.Host(), target.Port(), "", 0, self.Timeout(), "REPLACE", "KEYS", keys...)
+		if err = self.MigrateKeys(src, target, keys, false); err != nil {
+			if o.Fix && strings.Contains(err.Error(), "BUSYKEY") {
+				logrus.Printf("*** Target key exists. Replacing it for FIX.")
+				err = self.MigrateKeys(src, target, keys, true)
+			}
 			if err != nil {
-				errinfo := err.Error()
-				if o.Fix && strings.Contains(errinfo, "BUSYKEY") {
-					logrus.Printf("*** Target key exists. Replacing it for FIX.")
-					// XXX: migrate parameters check
-					cmd = cmd[:0]
-					cmd = append(cmd, target.Host(), target.Port(), "", 0, self.Timeout(), true, true, keys)
-					_, _ = source.Source.Call("migrate", cmd...)
-					// _, _ = source.Source.Call("migrate", target.Host(), target.Port(), "", 0, self.Timeout(), keys, keys)
-				} else {
-					logrus.Printf("\n")
-					logrus.Fatalf("[ERR] Calling MIGRATE: %s", errinfo)
-				}
+				fmt.Println()
+				return NewError(ErrMigrate, src.String(), err, "[ERR] Calling MIGRATE for slot %d", slot)
 			}
 		}
+
 		if o.Dots {
-			logrus.Printf("%s", strings.Repeat(".", len(keys)))
+			fmt.Print(strings.Repeat(".", len(keys)))
 		}
 	}
 
-	//puts if !o[:quiet]
 	if !o.Quiet {
-		logrus.Printf("\n")
+		fmt.Println()
 	}
 
 	// Set the new node as the owner of the slot in all the known nodes.
 	if !o.Cold {
-		for _, n := range self.Nodes() {
-			if n.HasFlag("slave") {
-				continue
-			}
-			//  n.r.cluster("setslot",slot,"node",target.info[:name])
+		if err := self.SetSlotOwner(slot, src, target); err != nil {
+			return err
 		}
 	}
 
 	// Update the node logical config
 	if o.Update {
-		//source.info[:slots].delete(slot)
-		//target.info[:slots][slot] = true
+		src.DelSlot(slot)
+		target.AssignSlot(slot)
 	}
+	return nil
+}
+
+// Run CLUSTER SETSLOT <slot> NODE <target> in every master. The target and
+// the source are updated first, so that the slot is never left without an
+// owner in the nodes that really matter.
+func (self *RedisTrib) SetSlotOwner(slot int, source, target *ClusterNode) error {
+	if _, err := target.ClusterSetSlot(slot, "node", target.Name()); err != nil {
+		return NewError(ErrMigrate, target.String(), err, "[ERR] Setting slot %d owner", slot)
+	}
+	if _, err := source.ClusterSetSlot(slot, "node", target.Name()); err != nil {
+		return NewError(ErrMigrate, source.String(), err, "[ERR] Setting slot %d owner", slot)
+	}
+	for _, n := range self.Nodes() {
+		if n.HasFlag("slave") || n == source || n == target {
+			continue
+		}
+		if _, err := n.ClusterSetSlot(slot, "node", target.Name()); err != nil {
+			logrus.Warnf("*** Setting slot %d owner in %s: %s", slot, n.String(), err)
+		}
+	}
+	return nil
+}
+
+// Move the given keys from source to target with a single MIGRATE call:
+// MIGRATE host port "" 0 timeout [REPLACE] [AUTH ..] KEYS key1 .. keyN
+func (self *RedisTrib) MigrateKeys(source, target *ClusterNode, keys []string, replace bool) error {
+	args := []interface{}{target.Host(), target.Port(), "", 0, self.Timeout()}
+	if replace {
+		args = append(args, "REPLACE")
+	}
+	args = target.Credentials().MigrateArgs(args)
+	args = append(args, "KEYS")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+
+	_, err := source.Call("MIGRATE", args...)
+	return err
 }
 
 // Given a list of source nodes return a "resharding plan"
@@ -742,7 +1059,7 @@ func (self *RedisTrib) ComputeReshardTable(sources ClusterArray, numSlots int) [
 	//    perfect divisibility. Like we have 3 nodes and need to get 10
 	//    slots, we take 4 from the first, and 3 from the rest. So the
 	//    biggest is always the first.
-	sort.Sort(ClusterArray(sources))
+	sort.Sort(sort.Reverse(sources))
 
 	sourceTotSlots := 0
 	for _, node := range sources {
@@ -750,7 +1067,7 @@ func (self *RedisTrib) ComputeReshardTable(sources ClusterArray, numSlots int) [
 	}
 
 	for idx, node := range sources {
-		n := float64(numSlots) / float64(sourceTotSlots*len(node.Slots()))
+		n := float64(numSlots) / float64(sourceTotSlots) * float64(len(node.Slots()))
 
 		if idx == 0 {
 			n = math.Ceil(n)
@@ -766,7 +1083,7 @@ func (self *RedisTrib) ComputeReshardTable(sources ClusterArray, numSlots int) [
 		}
 		sort.Ints(keys)
 
-		for i := 0; i < int(n); i++ {
+		for i := 0; i < int(n) && i < len(keys); i++ {
 			if len(moved) < numSlots {
 				mnode := &MovedNode{
 					Source: node,
@@ -784,3 +1101,13 @@ func (self *RedisTrib) ShowReshardTable(table []*MovedNode) {
 		logrus.Printf("    Moving slot %d from %s", node.Slot, node.Source.Name())
 	}
 }
+
+func removeClusterNode(nodes [](*ClusterNode), node *ClusterNode) [](*ClusterNode) {
+	result := nodes[:0]
+	for _, n := range nodes {
+		if n != node {
+			result = append(result, n)
+		}
+	}
+	return result
+}
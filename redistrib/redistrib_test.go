@@ -0,0 +1,244 @@
+package redistrib_test
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+// Start n fake nodes making a cluster with the given replicas per master.
+func newCluster(t *testing.T, n, replicas int) *redistest.Cluster {
+	t.Helper()
+	c, err := redistest.NewCluster(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	if err := c.Bootstrap(replicas); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// Load the cluster through its first live node.
+func load(t *testing.T, c *redistest.Cluster) *redistrib.RedisTrib {
+	t.Helper()
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(c.Dialer())
+	var addrs []string
+	for _, n := range c.Nodes() {
+		if !n.IsDown() {
+			addrs = append(addrs, n.Addr())
+		}
+	}
+	if err := rt.LoadCluster(addrs...); err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+func node(t *testing.T, rt *redistrib.RedisTrib, n *redistest.Node) *redistrib.ClusterNode {
+	t.Helper()
+	node := rt.GetNodeByName(n.ID())
+	if node == nil {
+		t.Fatalf("node %s not loaded", n.Addr())
+	}
+	return node
+}
+
+// A key hashing to the slot.
+func keyInSlot(slot int) string {
+	for i := 0; ; i++ {
+		key := "key:" + strconv.Itoa(i)
+		if int(redistrib.Key2Slot(key)) == slot {
+			return key
+		}
+	}
+}
+
+// Store a key in each of the slots, on the master owning it.
+func fill(t *testing.T, c *redistest.Cluster, slots ...int) []string {
+	t.Helper()
+	var keys []string
+	for _, slot := range slots {
+		key := keyInSlot(slot)
+		c.SlotOwner(slot).Set(key, "value")
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Make the cluster meet the node, as add-node does.
+func meet(t *testing.T, c *redistest.Cluster, n *redistest.Node) {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(n.Addr())
+	if _, err := c.Nodes()[0].Do("CLUSTER", "MEET", host, port); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadOpenSlots(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	source, target := c.SlotOwner(0), c.SlotOwner(16383)
+	if _, err := target.Do("CLUSTER", "SETSLOT", "42", "IMPORTING", source.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Do("CLUSTER", "SETSLOT", "42", "MIGRATING", target.ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := load(t, c)
+	if got := node(t, rt, source).Migrating(); got[42] != target.ID() || len(got) != 1 {
+		t.Errorf("migrating slots of the source = %v, want slot 42 to %s", got, target.ID())
+	}
+	if got := node(t, rt, target).Importing(); got[42] != source.ID() || len(got) != 1 {
+		t.Errorf("importing slots of the target = %v, want slot 42 from %s", got, source.ID())
+	}
+
+	rt.SetFix(true)
+	if err := rt.CheckOpenSlots(); err != nil {
+		t.Fatal(err)
+	}
+	if owner := c.SlotOwner(42); owner != source && owner != target {
+		t.Errorf("slot 42 owned by %v after the fix", owner)
+	}
+	rt = load(t, c)
+	for _, n := range rt.Nodes() {
+		if len(n.Migrating()) > 0 || len(n.Importing()) > 0 {
+			t.Errorf("%s still has open slots after the fix", n.String())
+		}
+	}
+}
+
+func ExampleRedisTrib_RunJournal() {
+	c, err := redistest.NewCluster(3)
+	if err != nil {
+		panic(err)
+	}
+	defer c.Close()
+	c.Bootstrap(0)
+
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(c.Dialer())
+	if err := rt.LoadCluster(c.Addrs()...); err != nil {
+		panic(err)
+	}
+	source := rt.GetNodeByName(c.SlotOwner(0).ID())
+	target := rt.GetNodeByName(c.SlotOwner(16383).ID())
+
+	journal := redistrib.NewJournal("", "reshard")
+	journal.AddMoves(rt.ComputeReshardTable(redistrib.ClusterArray{source}, 100), target)
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		panic(err)
+	}
+	fmt.Println(len(target.Slots()))
+	// Output: 5562
+}
+
+// Dialer timing out on the blackholed addresses after the dial timeout,
+// counting the dials in progress.
+type blackholeDialer struct {
+	redistrib.Dialer
+	timeout   time.Duration
+	blackhole map[string]bool
+
+	mu       sync.Mutex
+	dialing  int
+	maxDials int
+}
+
+func (d *blackholeDialer) Dial(addr string) (redistrib.Conn, error) {
+	d.mu.Lock()
+	d.dialing++
+	if d.dialing > d.maxDials {
+		d.maxDials = d.dialing
+	}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		d.dialing--
+		d.mu.Unlock()
+	}()
+
+	if d.blackhole[addr] {
+		time.Sleep(d.timeout)
+		return nil, fmt.Errorf("dial tcp %s: i/o timeout", addr)
+	}
+	return d.Dialer.Dial(addr)
+}
+
+func TestLoadUnreachableFriends(t *testing.T) {
+	c := newCluster(t, 9, 2)
+	nodes := c.Nodes()
+	// two replicas behind a partition, one failed as seen by the cluster
+	dialer := &blackholeDialer{Dialer: c.Dialer(), timeout: 200 * time.Millisecond,
+		blackhole: map[string]bool{nodes[3].Addr(): true, nodes[4].Addr(): true}}
+	nodes[5].Close()
+
+	for _, workers := range []int{redistrib.DefaultDiscoveryWorkers, 2} {
+		dialer.maxDials = 0
+		rt := redistrib.NewRedisTrib()
+		rt.SetDialer(dialer)
+		rt.SetWorkers(workers)
+		start := time.Now()
+		if err := rt.LoadClusterInfoFromNode(nodes[0].Addr()); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*dialer.timeout {
+			t.Errorf("loading with %d workers took %s, more than the dial timeout of %s", workers, elapsed, dialer.timeout)
+		}
+		if dialer.maxDials > workers {
+			t.Errorf("%d nodes dialed at once by %d workers", dialer.maxDials, workers)
+		}
+
+		unreachable := make(map[string]bool)
+		for _, u := range rt.Unreachable() {
+			unreachable[u.Addr] = true
+		}
+		for _, n := range nodes[3:6] {
+			if !unreachable[n.Addr()] {
+				t.Errorf("%s not listed as unreachable with %d workers", n.Addr(), workers)
+			}
+		}
+		if len(unreachable) != 3 || len(rt.Nodes()) != 6 {
+			t.Errorf("%d nodes loaded and %d unreachable with %d workers, want 6 and 3", len(rt.Nodes()), len(unreachable), workers)
+		}
+	}
+}
+
+func TestLoadInfoLinkStatus(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	down := c.Nodes()[5]
+	down.Close()
+
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(c.Dialer())
+	n, err := rt.NewNode(c.Nodes()[0].Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.LoadInfo(true); err != nil {
+		t.Fatal(err)
+	}
+	if got := n.Info().LinkStatus(); got != "connected" {
+		t.Errorf("link status of the node itself = %q, want connected", got)
+	}
+	if len(n.Friends()) != 5 {
+		t.Fatalf("%d friends loaded, want 5", len(n.Friends()))
+	}
+	for _, f := range n.Friends() {
+		want := "connected"
+		if f.String() == down.Addr() {
+			want = "disconnected"
+		}
+		if got := f.LinkStatus(); got != want {
+			t.Errorf("link status of %s = %q, want %s", f.String(), got, want)
+		}
+	}
+}
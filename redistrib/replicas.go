@@ -0,0 +1,250 @@
+package redistrib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// A master serving slots and its replicas.
+type shard struct {
+	master   *ClusterNode
+	replicas []*ClusterNode
+}
+
+// Hosts of the nodes of the shard, with their number of nodes, skipping
+// the given node.
+func (s *shard) hosts(skip *ClusterNode) map[string]int {
+	hosts := map[string]int{s.master.Host(): 1}
+	for _, r := range s.replicas {
+		if r != skip {
+			hosts[r.Host()]++
+		}
+	}
+	return hosts
+}
+
+// Whether the replica shares its host with another node of its shard.
+func (s *shard) misplaced(r *ClusterNode) bool {
+	return s.hosts(r)[r.Host()] > 0
+}
+
+func (s *shard) remove(r *ClusterNode) {
+	for i, n := range s.replicas {
+		if n == r {
+			s.replicas = append(s.replicas[:i:i], s.replicas[i+1:]...)
+			return
+		}
+	}
+}
+
+// The masters serving slots with their loaded replicas.
+func (self *RedisTrib) shards() []*shard {
+	var shards []*shard
+	for _, node := range self.Masters() {
+		if len(node.Slots()) == 0 {
+			continue
+		}
+		s := &shard{master: node}
+		s.replicas = append(s.replicas, node.ReplicasNodes()...)
+		shards = append(shards, s)
+	}
+	return shards
+}
+
+// Whether the nodes of the cluster run on more than one host, the host
+// checks are meaningless otherwise.
+func (self *RedisTrib) multiHost() bool {
+	for _, node := range self.Nodes() {
+		if node.Host() != self.Nodes()[0].Host() {
+			return true
+		}
+	}
+	return false
+}
+
+// Check that every master has replicas, evenly, and that the replicas
+// of a master don't run on its host or on the host of another replica.
+// In fix mode the replicas are reassigned with CLUSTER REPLICATE.
+func (self *RedisTrib) CheckReplicas() error {
+	logrus.Printf(">>> Check replicas...")
+	shards := self.shards()
+	if len(shards) == 0 {
+		return nil
+	}
+
+	problems := replicaProblems(shards, self.multiHost())
+	for _, p := range problems {
+		self.ClusterError(p)
+	}
+	if len(problems) == 0 {
+		logrus.Printf("[OK] Replicas are balanced across masters and hosts.")
+		return nil
+	}
+	if self.fix {
+		return self.FixReplicas(shards)
+	}
+	return nil
+}
+
+func replicaProblems(shards []*shard, multiHost bool) []*Problem {
+	var problems []*Problem
+
+	min, max := len(shards[0].replicas), len(shards[0].replicas)
+	for _, s := range shards {
+		if len(s.replicas) == 0 {
+			problems = append(problems, &Problem{
+				Category: ProblemNoReplica,
+				Node:     s.master.String(),
+				Message:  fmt.Sprintf("Master %s has no replica.", s.master.String()),
+			})
+		}
+		if len(s.replicas) < min {
+			min = len(s.replicas)
+		}
+		if len(s.replicas) > max {
+			max = len(s.replicas)
+		}
+	}
+	if max-min > 1 {
+		problems = append(problems, &Problem{
+			Category: ProblemUnevenReplicas,
+			Message:  fmt.Sprintf("Masters have between %d and %d replicas.", min, max),
+		})
+	}
+
+	if !multiHost {
+		return problems
+	}
+	for _, s := range shards {
+		shared := make(map[string][]string)
+		var hosts []string
+		for _, r := range s.replicas {
+			if r.Host() == s.master.Host() {
+				problems = append(problems, &Problem{
+					Category: ProblemReplicaSameHost,
+					Node:     r.String(),
+					Message: fmt.Sprintf("Replica %s runs on the same host as its master %s.",
+						r.String(), s.master.String()),
+				})
+			} else {
+				if shared[r.Host()] == nil {
+					hosts = append(hosts, r.Host())
+				}
+				shared[r.Host()] = append(shared[r.Host()], r.String())
+			}
+		}
+		for _, host := range hosts {
+			if addrs := shared[host]; len(addrs) > 1 {
+				problems = append(problems, &Problem{
+					Category: ProblemShardSameHost,
+					Node:     s.master.String(),
+					Message: fmt.Sprintf("Replicas %s of master %s run on the same host %s.",
+						strings.Join(addrs, ", "), s.master.String(), host),
+				})
+			}
+		}
+	}
+	return problems
+}
+
+// Reassign the replicas so that the masters have about the same number
+// of replicas, on other hosts than the other nodes of their shard when
+// possible.
+func (self *RedisTrib) FixReplicas(shards []*shard) error {
+	masterOf := make(map[*ClusterNode]*shard)
+	var replicas []*ClusterNode
+	for _, s := range shards {
+		for _, r := range s.replicas {
+			masterOf[r] = s
+			replicas = append(replicas, r)
+		}
+	}
+	move := func(r *ClusterNode, to *shard) {
+		masterOf[r].remove(r)
+		to.replicas = append(to.replicas, r)
+		masterOf[r] = to
+	}
+
+	// Give replicas to the masters having the fewest, from the masters
+	// having the most, preferring the replicas well placed on arrival.
+	for {
+		from, to := shards[0], shards[0]
+		for _, s := range shards {
+			if len(s.replicas) > len(from.replicas) {
+				from = s
+			}
+			if len(s.replicas) < len(to.replicas) {
+				to = s
+			}
+		}
+		if len(from.replicas)-len(to.replicas) <= 1 {
+			break
+		}
+		best := from.replicas[0]
+		for _, r := range from.replicas {
+			if to.hosts(nil)[r.Host()] == 0 {
+				best = r
+				if from.misplaced(r) {
+					break
+				}
+			}
+		}
+		move(best, to)
+	}
+
+	// Move or swap the misplaced replicas to the shards without a node
+	// on their host, keeping the replica counts.
+	for _, s := range shards {
+		for _, r := range append([]*ClusterNode(nil), s.replicas...) {
+			if !s.misplaced(r) {
+				continue
+			}
+			fixed := false
+			for _, t := range shards {
+				if t == s || t.hosts(nil)[r.Host()] > 0 {
+					continue
+				}
+				if len(t.replicas) < len(s.replicas) {
+					move(r, t)
+					fixed = true
+					break
+				}
+				for _, other := range t.replicas {
+					if s.hosts(r)[other.Host()] == 0 && t.hosts(other)[r.Host()] == 0 {
+						move(r, t)
+						move(other, s)
+						fixed = true
+						break
+					}
+				}
+				if fixed {
+					break
+				}
+			}
+			if !fixed {
+				logrus.Warnf("*** No master to move replica %s to, it stays on the host of its shard.", r.String())
+			}
+		}
+	}
+
+	for _, s := range shards {
+		if len(s.replicas) == 0 {
+			logrus.Warnf("*** Not enough replicas to give one to master %s.", s.master.String())
+		}
+	}
+
+	for _, r := range replicas {
+		master := masterOf[r].master
+		if r.Replicate() == master.Name() {
+			continue
+		}
+		logrus.Printf(">>> Moving replica %s to master %s", r.String(), master.String())
+		if _, err := r.ClusterReplicateWithNodeID(master.Name()); err != nil {
+			return NewError(ErrUnknown, r.String(), err, "Failed to replicate master %s", master.String())
+		}
+		r.info.replicate = master.Name()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package redistrib_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+func TestFixReplicas(t *testing.T) {
+	c, err := redistest.NewCluster(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	// masters on .1, .2 and .3, their replicas on .2, .3 and .1
+	for _, host := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3", "127.0.0.2", "127.0.0.3", "127.0.0.1"} {
+		if _, err := c.AddNodeOn(host); err != nil {
+			t.Skipf("no %s loopback address: %s", host, err)
+		}
+	}
+	if err := c.Bootstrap(1); err != nil {
+		t.Fatal(err)
+	}
+	nodes := c.Nodes()
+	masters, replicas := nodes[:3], nodes[3:]
+
+	// the first master loses its replica to the second, on its host
+	if _, err := replicas[0].Do("CLUSTER", "REPLICATE", masters[1].ID()); err != nil {
+		t.Fatal(err)
+	}
+
+	rt := load(t, c)
+	rt.SetFix(true)
+	if err := rt.CheckReplicas(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range rt.Problems() {
+		got = append(got, p.Category)
+	}
+	sort.Strings(got)
+	want := []string{redistrib.ProblemNoReplica, redistrib.ProblemReplicaSameHost, redistrib.ProblemUnevenReplicas}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("problems %v, want %v", got, want)
+	}
+
+	for i, m := range masters {
+		var mine []*redistest.Node
+		for _, r := range replicas {
+			if r.Master() == m {
+				mine = append(mine, r)
+			}
+		}
+		if len(mine) != 1 {
+			t.Errorf("master %d has %d replicas after the fix, want 1", i, len(mine))
+			continue
+		}
+		if host(mine[0]) == host(m) {
+			t.Errorf("replica %s of master %d still on its host", mine[0].Addr(), i)
+		}
+	}
+
+	rt = load(t, c)
+	if err := rt.CheckReplicas(); err != nil {
+		t.Fatal(err)
+	}
+	if problems := rt.Problems(); len(problems) > 0 {
+		t.Errorf("replica problems left after the fix: %v", problems)
+	}
+}
+
+func host(n *redistest.Node) string {
+	return n.Addr()[:strings.LastIndex(n.Addr(), ":")]
+}
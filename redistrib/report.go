@@ -0,0 +1,176 @@
+package redistrib
+
+import (
+	"sort"
+)
+
+// Categories of the problems found by CheckCluster.
+const (
+	ProblemConfigInconsistent = "config-inconsistent"
+	ProblemFailedMaster       = "failed-master"
+	ProblemOpenSlot           = "open-slot"
+	ProblemUncoveredSlot      = "uncovered-slot"
+	ProblemNoReplica          = "no-replica"
+	ProblemUnevenReplicas     = "uneven-replicas"
+	ProblemReplicaSameHost    = "replica-same-host"
+	ProblemShardSameHost      = "shard-same-host"
+)
+
+// Severity of the problems, ordered like the monitoring plugin states.
+type Severity int
+
+const (
+	SeverityOK Severity = iota
+	SeverityWarning
+	SeverityCritical
+	SeverityUnknown
+)
+
+var severityNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+func (s Severity) String() string {
+	if s < SeverityOK || s > SeverityUnknown {
+		return severityNames[SeverityUnknown]
+	}
+	return severityNames[s]
+}
+
+var problemSeverities = map[string]Severity{
+	ProblemConfigInconsistent: SeverityWarning,
+	ProblemFailedMaster:       SeverityCritical,
+	ProblemOpenSlot:           SeverityWarning,
+	ProblemUncoveredSlot:      SeverityCritical,
+	ProblemNoReplica:          SeverityWarning,
+	ProblemUnevenReplicas:     SeverityWarning,
+	ProblemReplicaSameHost:    SeverityWarning,
+	ProblemShardSameHost:      SeverityWarning,
+}
+
+// The replica placement problems don't prevent moving slots around.
+var placementProblems = map[string]bool{
+	ProblemNoReplica:       true,
+	ProblemUnevenReplicas:  true,
+	ProblemReplicaSameHost: true,
+	ProblemShardSameHost:   true,
+}
+
+// A problem found in the cluster.
+type Problem struct {
+	Category string `json:"category"`
+	// Address of the node involved, if any.
+	Node    string   `json:"node,omitempty"`
+	Slots   []string `json:"slots,omitempty"`
+	Message string   `json:"message"`
+}
+
+func (p *Problem) Error() string {
+	return p.Message
+}
+
+// Severity of the problem, unknown categories are warnings.
+func (p *Problem) Severity() Severity {
+	if s, ok := problemSeverities[p.Category]; ok {
+		return s
+	}
+	return SeverityWarning
+}
+
+// The highest severity of the problems, SeverityOK when there are none.
+func MaxSeverity(problems []*Problem) Severity {
+	severity := SeverityOK
+	for _, p := range problems {
+		if s := p.Severity(); s > severity {
+			severity = s
+		}
+	}
+	return severity
+}
+
+// State of a node, as reported by check and info.
+type NodeReport struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+	// master or replica
+	Role  string   `json:"role"`
+	Flags []string `json:"flags"`
+	// ID of the master of a replica.
+	Master   string   `json:"master,omitempty"`
+	Slots    []string `json:"slots"`
+	NumSlots int      `json:"num_slots"`
+	// IDs of the replicas of a master.
+	Replicas []string `json:"replicas"`
+	Keys     int      `json:"keys"`
+}
+
+// State of the loaded cluster, with the problems found by CheckCluster.
+type ClusterReport struct {
+	Nodes        []*NodeReport `json:"nodes"`
+	Masters      int           `json:"masters"`
+	Replicas     int           `json:"replicas"`
+	Keys         int           `json:"keys"`
+	SlotsCovered int           `json:"slots_covered"`
+	Problems     []*Problem    `json:"problems"`
+	// Errors of the nodes the discovery could not load, by address.
+	Unreachable map[string]string `json:"unreachable,omitempty"`
+}
+
+// Report the state of the loaded cluster. The key counts are read from
+// the nodes, a node failing to answer counts 0 keys.
+func (self *RedisTrib) Report() *ClusterReport {
+	report := &ClusterReport{
+		Nodes:        []*NodeReport{},
+		SlotsCovered: len(self.CoveredSlots()),
+		Problems:     self.Problems(),
+	}
+	if report.Problems == nil {
+		report.Problems = []*Problem{}
+	}
+
+	for _, u := range self.Unreachable() {
+		if report.Unreachable == nil {
+			report.Unreachable = make(map[string]string)
+		}
+		report.Unreachable[u.Addr] = u.Err.Error()
+	}
+
+	for _, node := range self.Nodes() {
+		n := &NodeReport{
+			ID:       node.Name(),
+			Addr:     node.String(),
+			Role:     node.Role(),
+			Flags:    []string{},
+			Master:   node.Replicate(),
+			Replicas: []string{},
+		}
+		for _, flag := range node.Flags() {
+			// myself depends on the node the cluster was loaded from
+			if flag != "myself" {
+				n.Flags = append(n.Flags, flag)
+			}
+		}
+
+		slots := make([]int, 0, len(node.Slots()))
+		for slot := range node.Slots() {
+			slots = append(slots, slot)
+		}
+		sort.Ints(slots)
+		n.Slots = SlotRanges(slots)
+		n.NumSlots = len(slots)
+
+		for _, r := range node.ReplicasNodes() {
+			n.Replicas = append(n.Replicas, r.Name())
+		}
+		if keys, err := node.Dbsize(); err == nil {
+			n.Keys = keys
+		}
+
+		if node.HasFlag("master") {
+			report.Masters++
+			report.Keys += n.Keys
+		} else {
+			report.Replicas++
+		}
+		report.Nodes = append(report.Nodes, n)
+	}
+	return report
+}
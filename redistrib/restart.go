@@ -0,0 +1,120 @@
+package redistrib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Time to wait for a restarted node to rejoin when not given.
+const RestartDefaultTimeout = 5 * time.Minute
+
+// Options of RollingRestart.
+type RestartOpts struct {
+	// Restart the node, returning once it was stopped and started again.
+	// The rolling restart then waits for the node to rejoin.
+	Hook func(node *ClusterNode) error
+	// How the masters are failed over before their restart.
+	Failover *FailoverOpts
+	// Time to wait for a node to rejoin.
+	Timeout time.Duration
+}
+
+// Restart the nodes one at a time, the replicas first. The masters
+// serving slots are failed over to a replica first, and every node must
+// rejoin the cluster before the next one is restarted. It stops at the
+// first failure, the nodes left are not touched.
+func (self *RedisTrib) RollingRestart(o *RestartOpts) error {
+	var order []*ClusterNode
+	for _, node := range self.Nodes() {
+		if !node.HasFlag("master") {
+			order = append(order, node)
+		}
+	}
+	order = append(order, self.Masters()...)
+
+	for i, node := range order {
+		logrus.Printf(">>> Restarting %s (%d/%d)", node.String(), i+1, len(order))
+		if node.HasFlag("master") && len(node.Slots()) > 0 {
+			replica, err := self.failoverCandidate(node, "")
+			if err != nil {
+				return err
+			}
+			result, err := self.Failover(replica, o.Failover)
+			if err != nil {
+				return err
+			}
+			logrus.Printf("[OK] %s took over after %s.", replica.String(), result.Took.Round(time.Millisecond))
+		}
+
+		start := time.Now()
+		node.Disconnect()
+		if err := o.Hook(node); err != nil {
+			return NewError(ErrRestart, node.String(), err, "Restart hook failed")
+		}
+		if err := self.waitRejoin(node, o.Timeout); err != nil {
+			return err
+		}
+		logrus.Printf("[OK] %s rejoined the cluster after %s.", node.String(), time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// Wait until the node sees the cluster ok, its replication link is up if
+// it is a replica, and no other node flags it as failing.
+func (self *RedisTrib) waitRejoin(node *ClusterNode, timeout time.Duration) error {
+	if self.dryRun != nil {
+		// the node was not restarted
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = RestartDefaultTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := self.rejoined(node)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return NewError(ErrRestart, node.String(), err, "Node did not rejoin after %s", timeout)
+		}
+		// the connection may be to the node before its restart
+		node.Disconnect()
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func (self *RedisTrib) rejoined(node *ClusterNode) error {
+	fields, err := node.ClusterInfoFields()
+	if err != nil {
+		return err
+	}
+	if state := fields["cluster_state"]; state != "ok" {
+		return fmt.Errorf("cluster_state is %s", state)
+	}
+
+	fields, err = node.InfoFields("replication")
+	if err != nil {
+		return err
+	}
+	if fields["role"] == "slave" && fields["master_link_status"] != "up" {
+		return fmt.Errorf("link to the master is %s", fields["master_link_status"])
+	}
+
+	for _, other := range self.Nodes() {
+		if other == node {
+			continue
+		}
+		view, err := other.ClusterNodesView()
+		if err != nil {
+			return fmt.Errorf("%s: %s", other.String(), err)
+		}
+		if info := view[node.Name()]; info != nil && info.HasFlag("fail") {
+			return fmt.Errorf("%s flags it %s", other.String(), info.flags)
+		}
+	}
+	return nil
+}
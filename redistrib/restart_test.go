@@ -0,0 +1,113 @@
+package redistrib_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+// Restart options with a hook stopping and starting the fake node, after
+// calling check on it.
+func restartOpts(t *testing.T, c *redistest.Cluster, check func(n *redistest.Node) error) *redistrib.RestartOpts {
+	return &redistrib.RestartOpts{
+		Hook: func(node *redistrib.ClusterNode) error {
+			n := c.NodeByAddr(node.String())
+			if n == nil {
+				t.Fatalf("hook called for unknown node %s", node.String())
+			}
+			if err := check(n); err != nil {
+				return err
+			}
+			n.Close()
+			return n.Restart()
+		},
+		Failover: &redistrib.FailoverOpts{MaxLag: redistrib.NoMaxLag, Timeout: 5 * time.Second},
+		Timeout:  5 * time.Second,
+	}
+}
+
+func TestRollingRestart(t *testing.T) {
+	c := newCluster(t, 6, 1)
+	masters := make(map[*redistest.Node]bool)
+	for _, n := range c.Nodes() {
+		if n.Master() == nil {
+			masters[n] = true
+		}
+	}
+
+	restarted := make(map[*redistest.Node]int)
+	rt := load(t, c)
+	err := rt.RollingRestart(restartOpts(t, c, func(n *redistest.Node) error {
+		if masters[n] && len(restarted) < len(c.Nodes())-len(masters) {
+			t.Errorf("master %s restarted before the replicas", n.Addr())
+		}
+		if len(n.Slots()) > 0 {
+			t.Errorf("%s restarted while serving %d slots", n.Addr(), len(n.Slots()))
+		}
+		restarted[n]++
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range c.Nodes() {
+		if restarted[n] != 1 {
+			t.Errorf("%s restarted %d times, want once", n.Addr(), restarted[n])
+		}
+		if masters[n] && n.Master() == nil {
+			t.Errorf("former master %s is still a master", n.Addr())
+		}
+	}
+	for slot := 0; slot < redistrib.ClusterHashSlots; slot++ {
+		if c.SlotOwner(slot) == nil {
+			t.Fatalf("slot %d not covered after the rolling restart", slot)
+		}
+	}
+}
+
+func TestRollingRestartHookFailure(t *testing.T) {
+	c := newCluster(t, 6, 1)
+
+	calls := 0
+	rt := load(t, c)
+	err := rt.RollingRestart(restartOpts(t, c, func(n *redistest.Node) error {
+		calls++
+		if calls == 2 {
+			return errors.New("exit status 1")
+		}
+		return nil
+	}))
+	if redistrib.KindOf(err) != redistrib.ErrRestart {
+		t.Errorf("rolling restart with a failing hook returned %v, want a restart failure", err)
+	}
+	if calls != 2 {
+		t.Errorf("hook called %d times, want the restart to stop at the failure", calls)
+	}
+}
+
+func TestRollingRestartNodeNotBack(t *testing.T) {
+	c := newCluster(t, 6, 1)
+
+	calls := 0
+	rt := load(t, c)
+	opts := &redistrib.RestartOpts{
+		Hook: func(node *redistrib.ClusterNode) error {
+			calls++
+			// stopped, never started again
+			c.NodeByAddr(node.String()).Close()
+			return nil
+		},
+		Failover: &redistrib.FailoverOpts{MaxLag: redistrib.NoMaxLag, Timeout: 5 * time.Second},
+		Timeout:  time.Second,
+	}
+	if err := rt.RollingRestart(opts); redistrib.KindOf(err) != redistrib.ErrRestart {
+		t.Errorf("rolling restart of a node not coming back returned %v, want a restart failure", err)
+	}
+	if calls != 1 {
+		t.Errorf("hook called %d times, want the restart to stop at the first node", calls)
+	}
+}
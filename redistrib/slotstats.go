@@ -0,0 +1,119 @@
+package redistrib
+
+import (
+	"sort"
+)
+
+// Slots counted per round trip by SlotStats when not given.
+const SlotStatsDefaultPipeline = 1000
+
+// The number of keys of a slot.
+type SlotCount struct {
+	Slot int `json:"slot"`
+	Keys int `json:"keys"`
+	// Address of the master owning the slot.
+	Master string `json:"master"`
+}
+
+// The number of slots having between Min and Max keys.
+type HistogramBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Slots int `json:"slots"`
+}
+
+// The share of the keys of a master compared with its share of slots.
+type MasterShare struct {
+	ID        string  `json:"id"`
+	Addr      string  `json:"addr"`
+	Slots     int     `json:"slots"`
+	Keys      int     `json:"keys"`
+	SlotShare float64 `json:"slot_share"`
+	KeyShare  float64 `json:"key_share"`
+}
+
+// The distribution of the keys across the slots of the cluster.
+type SlotStats struct {
+	Keys int `json:"keys"`
+	// Every covered slot, in order.
+	Slots     []*SlotCount       `json:"slots"`
+	Histogram []*HistogramBucket `json:"histogram"`
+	// The heaviest slots first.
+	Top     []*SlotCount   `json:"top"`
+	Masters []*MasterShare `json:"masters"`
+}
+
+// Count the keys of every slot on its master, pipeline slots per round
+// trip, and report their distribution with the top heaviest slots.
+func (self *RedisTrib) SlotStats(pipeline, top int) (*SlotStats, error) {
+	if pipeline <= 0 {
+		pipeline = SlotStatsDefaultPipeline
+	}
+
+	stats := &SlotStats{
+		Slots:     []*SlotCount{},
+		Histogram: []*HistogramBucket{},
+		Top:       []*SlotCount{},
+		Masters:   []*MasterShare{},
+	}
+	for _, node := range self.Masters() {
+		slots := make([]int, 0, len(node.Slots()))
+		for slot := range node.Slots() {
+			slots = append(slots, slot)
+		}
+		if len(slots) == 0 {
+			continue
+		}
+		sort.Ints(slots)
+
+		counts, err := node.ClusterCountKeysInSlots(slots, pipeline)
+		if err != nil {
+			return nil, NewError(ErrConnection, node.String(), err, "Count keys in slots failed")
+		}
+		share := &MasterShare{ID: node.Name(), Addr: node.String(), Slots: len(slots)}
+		for _, slot := range slots {
+			stats.Slots = append(stats.Slots, &SlotCount{Slot: slot, Keys: counts[slot], Master: node.String()})
+			share.Keys += counts[slot]
+		}
+		stats.Keys += share.Keys
+		stats.Masters = append(stats.Masters, share)
+	}
+	sort.Slice(stats.Slots, func(i, j int) bool { return stats.Slots[i].Slot < stats.Slots[j].Slot })
+
+	for _, share := range stats.Masters {
+		share.SlotShare = float64(share.Slots) / float64(ClusterHashSlots)
+		if stats.Keys > 0 {
+			share.KeyShare = float64(share.Keys) / float64(stats.Keys)
+		}
+	}
+
+	// Buckets of 0 keys, then 1-9, 10-99, and so on.
+	buckets := make(map[int]*HistogramBucket)
+	for _, s := range stats.Slots {
+		min, max := 0, 0
+		if s.Keys > 0 {
+			min, max = 1, 9
+			for s.Keys > max {
+				min, max = max+1, max*10+9
+			}
+		}
+		b := buckets[min]
+		if b == nil {
+			b = &HistogramBucket{Min: min, Max: max}
+			buckets[min] = b
+			stats.Histogram = append(stats.Histogram, b)
+		}
+		b.Slots++
+	}
+	sort.Slice(stats.Histogram, func(i, j int) bool { return stats.Histogram[i].Min < stats.Histogram[j].Min })
+
+	heaviest := append([]*SlotCount(nil), stats.Slots...)
+	sort.SliceStable(heaviest, func(i, j int) bool { return heaviest[i].Keys > heaviest[j].Keys })
+	if top > len(heaviest) {
+		top = len(heaviest)
+	} else if top < 0 {
+		top = 0
+	}
+	stats.Top = append(stats.Top, heaviest[:top]...)
+	return stats, nil
+}
@@ -0,0 +1,85 @@
+package redistrib_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func TestSlotStats(t *testing.T) {
+	c := newCluster(t, 3, 0)
+	first, last := c.SlotOwner(0), c.SlotOwner(16383)
+	counts := map[int]int{0: 150, 1: 20, 2: 5, 16383: 1}
+	for slot, n := range counts {
+		tag := "{" + keyInSlot(slot) + "}:"
+		for i := 0; i < n; i++ {
+			c.SlotOwner(slot).Set(tag+strconv.Itoa(i), "value")
+		}
+	}
+
+	rt := load(t, c)
+	stats, err := rt.SlotStats(100, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Keys != 176 || len(stats.Slots) != redistrib.ClusterHashSlots {
+		t.Fatalf("%d keys in %d slots, want 176 keys in every slot", stats.Keys, len(stats.Slots))
+	}
+	for i, s := range stats.Slots {
+		if s.Slot != i || s.Keys != counts[i] {
+			t.Errorf("slot %d counted as slot %d with %d keys, want %d", i, s.Slot, s.Keys, counts[i])
+		}
+	}
+
+	want := []redistrib.HistogramBucket{
+		{Min: 0, Max: 0, Slots: redistrib.ClusterHashSlots - 4},
+		{Min: 1, Max: 9, Slots: 2},
+		{Min: 10, Max: 99, Slots: 1},
+		{Min: 100, Max: 999, Slots: 1},
+	}
+	if len(stats.Histogram) != len(want) {
+		t.Fatalf("histogram of %d buckets, want %d", len(stats.Histogram), len(want))
+	}
+	for i, b := range stats.Histogram {
+		if *b != want[i] {
+			t.Errorf("bucket %d is %+v, want %+v", i, *b, want[i])
+		}
+	}
+
+	if len(stats.Top) != 3 {
+		t.Fatalf("top of %d slots, want 3", len(stats.Top))
+	}
+	for i, slot := range []int{0, 1, 2} {
+		if stats.Top[i].Slot != slot || stats.Top[i].Master != first.Addr() {
+			t.Errorf("top %d is slot %d on %s, want slot %d on %s", i, stats.Top[i].Slot, stats.Top[i].Master, slot, first.Addr())
+		}
+	}
+
+	for _, share := range stats.Masters {
+		keys := 0
+		switch share.ID {
+		case first.ID():
+			keys = 175
+		case last.ID():
+			keys = 1
+		}
+		if share.Keys != keys || share.KeyShare != float64(keys)/176 {
+			t.Errorf("master %s has %d keys, a %.3f share, want %d", share.Addr, share.Keys, share.KeyShare, keys)
+		}
+		if share.SlotShare != float64(share.Slots)/redistrib.ClusterHashSlots {
+			t.Errorf("master %s has %d slots, a %.3f share", share.Addr, share.Slots, share.SlotShare)
+		}
+	}
+
+	// the top is clamped to the slots of the cluster
+	for top, want := range map[int]int{-1: 0, 0: 0, redistrib.ClusterHashSlots + 1: redistrib.ClusterHashSlots} {
+		stats, err := rt.SlotStats(0, top)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats.Top) != want {
+			t.Errorf("top %d gave %d slots, want %d", top, len(stats.Top), want)
+		}
+	}
+}
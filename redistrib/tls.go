@@ -0,0 +1,95 @@
+package redistrib
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// TLS settings of the node connections, the certificates are read by
+// Load, or by the first dial.
+type TLSOptions struct {
+	Enabled  bool
+	CACert   string
+	Cert     string
+	Key      string
+	SNI      string
+	Insecure bool
+
+	config *tls.Config
+}
+
+// Settings of the node connections, TLS is off by default.
+var DefaultTLS = &TLSOptions{}
+
+// Check the options and prepare the tls.Config used to dial the nodes.
+func (self *TLSOptions) Load() error {
+	if !self.Enabled {
+		if self.CACert != "" || self.Cert != "" || self.Key != "" ||
+			self.SNI != "" || self.Insecure {
+			return fmt.Errorf("TLS options require --tls")
+		}
+		return nil
+	}
+
+	config, err := self.Build()
+	if err != nil {
+		return err
+	}
+	self.config = config
+	return nil
+}
+
+// Build the tls.Config described by the options.
+func (self *TLSOptions) Build() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         self.SNI,
+		InsecureSkipVerify: self.Insecure,
+	}
+
+	if self.CACert != "" {
+		pem, err := ioutil.ReadFile(self.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("read CA certificate %s failed: %s", self.CACert, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", self.CACert)
+		}
+		config.RootCAs = pool
+	}
+
+	if self.Cert != "" || self.Key != "" {
+		if self.Cert == "" || self.Key == "" {
+			return nil, fmt.Errorf("options --cert and --key must be given together")
+		}
+		cert, err := tls.LoadX509KeyPair(self.Cert, self.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate failed: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// Dial options enabling TLS on a node connection, if configured. The
+// options are loaded first if Load was not called.
+func (self *TLSOptions) DialOptions() ([]redis.DialOption, error) {
+	if !self.Enabled {
+		return nil, nil
+	}
+	if self.config == nil {
+		if err := self.Load(); err != nil {
+			return nil, err
+		}
+	}
+	return []redis.DialOption{
+		redis.DialUseTLS(true),
+		redis.DialTLSConfig(self.config),
+		redis.DialTLSSkipVerify(self.Insecure),
+	}, nil
+}
@@ -0,0 +1,138 @@
+package redistrib_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+	"github.com/soarpenguin/redis-trib/redistrib/redistest"
+)
+
+// Start a cluster accepting TLS next to plain connections, and make the
+// options the default ones for the duration of the test, as --tls does.
+func newTLSCluster(t *testing.T, opts *redistrib.TLSOptions) (*redistest.Cluster, *redistest.Certs) {
+	t.Helper()
+	certs, err := redistest.NewCerts(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCluster(t, 3, 0)
+	if err := c.ListenTLS(certs.ServerConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Enabled = true
+	if opts.CACert == "" {
+		opts.CACert = certs.CACert
+	}
+	saved := redistrib.DefaultTLS
+	redistrib.DefaultTLS = opts
+	t.Cleanup(func() { redistrib.DefaultTLS = saved })
+	return c, certs
+}
+
+func TestTLSCluster(t *testing.T) {
+	opts := &redistrib.TLSOptions{}
+	c, certs := newTLSCluster(t, opts)
+	opts.Cert, opts.Key = certs.Cert, certs.Key
+	keys := fill(t, c, 0)
+
+	// Load is not called, the first dial does it.
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(&redistrib.NetDialer{})
+	if err := rt.LoadCluster(c.Nodes()[0].TLSAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.Nodes()) != 3 {
+		t.Fatalf("%d nodes loaded over TLS, want 3", len(rt.Nodes()))
+	}
+	for _, n := range c.Nodes() {
+		node := node(t, rt, n)
+		if node.String() != n.TLSAddr() {
+			t.Errorf("node loaded as %s, want its TLS port %s", node.String(), n.TLSAddr())
+		}
+	}
+
+	source, target := c.SlotOwner(0), c.SlotOwner(16383)
+	journal := redistrib.NewJournal("", "reshard")
+	journal.AddMoves([]*redistrib.MovedNode{{Source: node(t, rt, source), Slot: 0}}, node(t, rt, target))
+	if err := rt.RunJournal(journal, &redistrib.MoveOpts{Update: true, Quiet: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if owner := c.SlotOwner(0); owner != target {
+		t.Errorf("slot 0 owned by %s, want %s", owner.Addr(), target.Addr())
+	}
+	if _, ok := target.Get(keys[0]); !ok {
+		t.Errorf("key %s not migrated over TLS", keys[0])
+	}
+}
+
+// The ports of the nodes follow the TLS setting of the dialer, not the
+// one of DefaultTLS.
+func TestTLSDialerPorts(t *testing.T) {
+	c, certs := newTLSCluster(t, &redistrib.TLSOptions{})
+	redistrib.DefaultTLS.Cert, redistrib.DefaultTLS.Key = certs.Cert, certs.Key
+
+	plain := &redistrib.NetDialer{TLS: &redistrib.TLSOptions{}}
+	tls := &redistrib.NetDialer{TLS: &redistrib.TLSOptions{Enabled: true, CACert: certs.CACert, Cert: certs.Cert, Key: certs.Key}}
+	for _, test := range []struct {
+		name   string
+		dialer redistrib.Dialer
+		addr   func(n *redistest.Node) string
+	}{
+		{"plain dialer with --tls", plain, (*redistest.Node).Addr},
+		{"TLS dialer without --tls", tls, (*redistest.Node).TLSAddr},
+	} {
+		if test.dialer == tls {
+			redistrib.DefaultTLS.Enabled = false
+		}
+		rt := redistrib.NewRedisTrib()
+		rt.SetDialer(test.dialer)
+		if err := rt.LoadCluster(test.addr(c.Nodes()[0])); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		for _, n := range c.Nodes() {
+			if node := node(t, rt, n); node.String() != test.addr(n) {
+				t.Errorf("%s: node loaded as %s, want %s", test.name, node.String(), test.addr(n))
+			}
+		}
+	}
+}
+
+func TestTLSClientCertificateRequired(t *testing.T) {
+	c, _ := newTLSCluster(t, &redistrib.TLSOptions{})
+
+	rt := redistrib.NewRedisTrib()
+	rt.SetDialer(&redistrib.NetDialer{})
+	if err := rt.LoadCluster(c.Nodes()[0].TLSAddr()); err == nil {
+		t.Error("cluster loaded without a client certificate")
+	}
+}
+
+func TestTLSOptionsErrors(t *testing.T) {
+	dir := t.TempDir()
+	certs, err := redistest.NewCerts(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts *redistrib.TLSOptions
+	}{
+		{"options without --tls", &redistrib.TLSOptions{CACert: certs.CACert}},
+		{"missing CA file", &redistrib.TLSOptions{Enabled: true, CACert: filepath.Join(dir, "none.crt")}},
+		{"CA file without certificate", &redistrib.TLSOptions{Enabled: true, CACert: certs.Key}},
+		{"certificate without key", &redistrib.TLSOptions{Enabled: true, Cert: certs.Cert}},
+	}
+	for _, test := range tests {
+		if err := test.opts.Load(); err == nil {
+			t.Errorf("%s: Load succeeded", test.name)
+		}
+		if test.opts.Enabled {
+			if _, err := test.opts.DialOptions(); err == nil {
+				t.Errorf("%s: DialOptions succeeded", test.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package redistrib_test
+
+import (
+	"testing"
+
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+func TestKey2Slot(t *testing.T) {
+	tests := []struct {
+		key  string
+		slot uint16
+	}{
+		{"123456789", 12739},
+		{"{user1000}.following", 3443},
+		{"user1000", 3443},
+		{"foo{bar}{zap}", 5061},
+		{"bar", 5061},
+		{"foo{{bar}}zap", 4015},
+		{"{bar", 4015},
+		// an empty hash tag hashes the whole key
+		{"foo{}{bar}", 8363},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := redistrib.Key2Slot(tt.key); got != tt.slot {
+			t.Errorf("Key2Slot(%q) = %d, want %d", tt.key, got, tt.slot)
+		}
+	}
+}
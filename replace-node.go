@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+//  replace-node    host:port old_id new_host:new_port
+//                  --max-lag <arg>
+//                  --sync-timeout <arg>
+//                  --failover-timeout <arg>
+var replaceNodeCommand = cli.Command{
+	Name:      "replace-node",
+	Usage:     "replace a redis node by a new one without downtime.",
+	ArgsUsage: `host:port old_id new_host:new_port`,
+	Description: `The replace-node command adds the empty new node as a replica of the
+   old node, or of its master when the old node is a replica, and waits
+   for its sync. A master is then failed over to the new node, which also
+   gets the other replicas of the old node. Finally the old node is
+   forgotten by the cluster and shut down, as del-node does.`,
+	Flags: []cli.Flag{
+		cli.Int64Flag{
+			Name:  "max-lag",
+			Value: redistrib.FailoverDefaultMaxLag,
+			Usage: `Replication offset the new node may lag behind its master, -1 not to check it.`,
+		},
+		cli.DurationFlag{
+			Name:  "sync-timeout",
+			Value: redistrib.ReplicaSyncDefaultTimeout,
+			Usage: `Time to wait for the new node to copy the dataset of its master.`,
+		},
+		cli.DurationFlag{
+			Name:  "failover-timeout",
+			Value: redistrib.FailoverDefaultTimeout,
+			Usage: `Time to wait for every node to see the failover to the new node.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 3 {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "replace-node")
+			return badArgument("Must provide \"host:port old_id new_host:new_port\" for replace-node command!")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.ReplaceNodeClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) ReplaceNodeClusterCmd(context *cli.Context) error {
+	var addr string
+	var oldid string
+	var newaddr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for replace-node command")
+	} else if oldid = context.Args().Get(1); oldid == "" {
+		return errors.New("please check old_id for replace-node command")
+	} else if newaddr = context.Args().Get(2); newaddr == "" {
+		return errors.New("please check new_host:new_port for replace-node command")
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+	if err := self.CheckCluster(true); err != nil {
+		return err
+	}
+	if len(self.SlotsProblems()) > 0 {
+		return redistrib.NewError(redistrib.ErrClusterUnhealthy, "", nil, "*** Please fix your cluster problem before replacing a node.")
+	}
+
+	old := self.GetNodeByAbbreviatedName(oldid)
+	if old == nil {
+		return badArgument("No such node ID %s", oldid)
+	}
+	master := old
+	wasMaster := old.HasFlag("master")
+	if !wasMaster {
+		if master = self.GetNodeByName(old.Replicate()); master == nil {
+			return redistrib.NewError(redistrib.ErrClusterUnhealthy, old.String(), nil,
+				"The master %s of the node is not reachable", old.Replicate())
+		}
+	}
+	logrus.Printf(">>> Replacing node %s by %s", old.String(), newaddr)
+
+	newNode, err := self.JoinNode(newaddr, addr, master)
+	if err != nil {
+		return err
+	}
+	if dryRun != nil {
+		// the new node did not join, nothing more can be planned
+		return nil
+	}
+	logrus.Printf(">>> Waiting for %s to sync with %s", newNode.String(), master.String())
+	if err := self.WaitReplicaSync(newNode, master, context.Int64("max-lag"), context.Duration("sync-timeout")); err != nil {
+		return err
+	}
+
+	if wasMaster {
+		if err := self.reload(addr); err != nil {
+			return err
+		}
+		if newNode = self.GetNodeByName(newNode.Name()); newNode == nil {
+			return redistrib.NewError(redistrib.ErrClusterUnhealthy, newaddr, nil, "The new node is not in the cluster")
+		}
+		result, err := self.Failover(newNode, &redistrib.FailoverOpts{
+			Mode:    redistrib.FailoverDefault,
+			MaxLag:  context.Int64("max-lag"),
+			Timeout: context.Duration("failover-timeout"),
+		})
+		if err != nil {
+			return err
+		}
+		showFailovers([]*redistrib.FailoverResult{result})
+	}
+
+	// Forget the old node from scratch, its slots are gone.
+	if err := self.reload(addr); err != nil {
+		return err
+	}
+	if old = self.GetNodeByName(old.Name()); old == nil {
+		return redistrib.NewError(redistrib.ErrClusterUnhealthy, "", nil, "The old node is not in the cluster anymore")
+	}
+	if wasMaster {
+		for _, n := range self.Nodes() {
+			if n.Replicate() != old.Name() || n.Name() == newNode.Name() {
+				continue
+			}
+			logrus.Printf(">>> %s as replica of %s", n.String(), newNode.String())
+			if _, err := n.ClusterReplicateWithNodeID(newNode.Name()); err != nil {
+				return redistrib.NewError(redistrib.ErrConnection, n.String(), err, "Configure node as replica failed")
+			}
+			n.SetReplicate(newNode.Name())
+		}
+	}
+	if err := self.RemoveNode(old); err != nil {
+		return err
+	}
+	logrus.Printf("[OK] Node %s replaced by %s.", old.String(), newNode.String())
+	return nil
+}
+
+// Load the cluster again from the node at addr.
+func (self *RedisTrib) reload(addr string) error {
+	self.ResetNodes()
+	return self.LoadClusterInfoFromNode(addr)
+}
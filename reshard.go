@@ -10,6 +10,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 //  reshard         host:port
@@ -19,6 +20,9 @@ import (
 //                  --yes
 //                  --timeout <arg>
 //                  --pipeline <arg>
+//                  --journal <arg>
+//                  --resume <arg>
+//                  --plan-out <arg>
 var reshardCommand = cli.Command{
 	Name:        "reshard",
 	Usage:       "reshard the redis cluster.",
@@ -50,12 +54,27 @@ var reshardCommand = cli.Command{
 			Value: "",
 			Usage: `Pipeline for reshard redis cluster.`,
 		},
+		cli.StringFlag{
+			Name:  "journal",
+			Value: "",
+			Usage: `Journal file recording the reshard progress, a temporary file by default.`,
+		},
+		cli.StringFlag{
+			Name:  "resume",
+			Value: "",
+			Usage: `Resume an interrupted reshard from its journal file.`,
+		},
+		cli.StringFlag{
+			Name:  "plan-out",
+			Value: "",
+			Usage: `Write the reshard plan as JSON to this file instead of moving slots.`,
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if context.NArg() != 1 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "reshard")
-			logrus.Fatalf("Must provide at least \"host:port\" for reshard command!")
+			return badArgument("Must provide at least \"host:port\" for reshard command!")
 		}
 		rt := NewRedisTrib()
 		if err := rt.ReshardClusterCmd(context); err != nil {
@@ -76,16 +95,36 @@ func (self *RedisTrib) ReshardClusterCmd(context *cli.Context) error {
 		return err
 	}
 
-	self.CheckCluster(false)
-
-	if len(self.Errors()) > 0 {
-		logrus.Fatalf("*** Please fix your cluster problem before resharding.")
+	if err := self.CheckCluster(false); err != nil {
+		return err
 	}
 
 	if context.Int("timeout") > 0 {
 		self.SetTimeout(context.Int("timeout"))
 	}
 
+	pipeline := redistrib.MigrateDefaultPipeline
+	if context.String("pipeline") != "" {
+		pnum, err := strconv.Atoi(context.String("pipeline"))
+		if err == nil {
+			pipeline = pnum
+		}
+	}
+	opts := &redistrib.MoveOpts{
+		Dots:     true,
+		Pipeline: pipeline,
+	}
+
+	// The slots left open by the interrupted run are expected here,
+	// the journal validation checks they are the ones it recorded.
+	if path := context.String("resume"); path != "" {
+		return resumeHint(self.ResumeJournal(path, "reshard", opts, nil), path)
+	}
+
+	if len(self.SlotsProblems()) > 0 {
+		return redistrib.NewError(redistrib.ErrClusterUnhealthy, "", nil, "*** Please fix your cluster problem before resharding.")
+	}
+
 	// Get number of slots
 	var numSlots int
 	if context.Int("slots") != 0 {
@@ -94,8 +133,8 @@ func (self *RedisTrib) ReshardClusterCmd(context *cli.Context) error {
 		numSlots = 0
 		reader := bufio.NewReader(os.Stdin)
 		for {
-			if numSlots <= 0 || numSlots > ClusterHashSlots {
-				fmt.Printf("How many slots do you want to move (from 1 to %d)? ", ClusterHashSlots)
+			if numSlots <= 0 || numSlots > redistrib.ClusterHashSlots {
+				fmt.Printf("How many slots do you want to move (from 1 to %d)? ", redistrib.ClusterHashSlots)
 				text, _ := reader.ReadString('\n')
 				num, err := strconv.ParseInt(strings.TrimSpace(text), 10, 0)
 				if err != nil {
@@ -109,12 +148,12 @@ func (self *RedisTrib) ReshardClusterCmd(context *cli.Context) error {
 	}
 
 	// Get the target instance
-	var target *ClusterNode
+	var target *redistrib.ClusterNode
 	if context.String("to") != "" {
 		target = self.GetNodeByName(context.String("to"))
 
 		if target == nil || target.HasFlag("slave") {
-			logrus.Fatalf("*** The specified node is not known or not a master, please retry.")
+			return badArgument("*** The specified node is not known or not a master, please retry.")
 		}
 	} else {
 		target = nil
@@ -150,7 +189,7 @@ func (self *RedisTrib) ReshardClusterCmd(context *cli.Context) error {
 			} else {
 				node := self.GetNodeByName(nodeID)
 				if node == nil || node.HasFlag("slave") {
-					logrus.Fatalf("*** The specified node is not known or not a master, please retry.")
+					return badArgument("*** The specified node is not known or not a master, please retry.")
 				}
 				sources = append(sources, node)
 			}
@@ -184,7 +223,7 @@ func (self *RedisTrib) ReshardClusterCmd(context *cli.Context) error {
 	}
 
 	if len(sources) <= 0 {
-		logrus.Fatalf("*** No source nodes given, operation aborted")
+		return badArgument("*** No source nodes given, operation aborted")
 	}
 
 	if len(sources) == 1 {
@@ -207,9 +246,9 @@ func (self *RedisTrib) ReshardClusterCmd(context *cli.Context) error {
 	// Check if the destination node is the same of any source nodes.
 	for _, node := range sources {
 		if node != nil {
-			if cnode, ok := node.(ClusterNode); ok {
+			if cnode, ok := node.(*redistrib.ClusterNode); ok {
 				if cnode.Name() == target.Name() {
-					logrus.Fatalf("*** Target node is also listed among the source nodes!")
+					return badArgument("*** Target node is also listed among the source nodes!")
 				}
 			}
 		}
@@ -217,46 +256,42 @@ func (self *RedisTrib) ReshardClusterCmd(context *cli.Context) error {
 
 	logrus.Printf("Ready to move %d slots.", numSlots)
 	logrus.Printf("  Source nodes:")
-	var srcs ClusterArray
+	var srcs redistrib.ClusterArray
 	for _, node := range sources {
-		if cnode, ok := node.(ClusterNode); ok {
-			fmt.Printf("\t%s", cnode.InfoString())
+		if cnode, ok := node.(*redistrib.ClusterNode); ok {
+			fmt.Printf("\t%s\n", cnode.InfoString())
 			srcs = append(srcs, cnode)
 		}
 	}
 	logrus.Printf("  Destination node: %s", target.InfoString())
 
-	// TODO: ComputeReshardTable
 	reshardTable := self.ComputeReshardTable(srcs, numSlots)
 	logrus.Printf("  Resharding plan:")
 	self.ShowReshardTable(reshardTable)
 
+	journal := redistrib.NewJournal(journalPath(context, "reshard"), "reshard")
+	journal.AddMoves(reshardTable, target)
+
+	if path := context.String("plan-out"); path != "" {
+		return self.WritePlan(path, journal)
+	}
+
 	if !context.Bool("yes") {
 		fmt.Printf("Do you want to proceed with the proposed reshard plan (yes/no)? ")
 		reader := bufio.NewReader(os.Stdin)
 		text, _ := reader.ReadString('\n')
 
 		if !strings.EqualFold(strings.TrimSpace(text), "yes") {
-			logrus.Fatalf("*** Aborting...")
+			return redistrib.NewError(redistrib.ErrAborted, "", nil, "*** Aborting...")
 		}
 	}
 
-	pipeline := MigrateDefaultPipeline
-	if context.String("pipeline") != "" {
-		pnum, err := strconv.Atoi(context.String("pipeline"))
-		if err == nil {
-			pipeline = pnum
-		}
-	}
-	opts := &MoveOpts{
-		Dots:     true,
-		Pipeline: pipeline,
+	if err := journal.Save(); err != nil {
+		return err
 	}
-	// TODO: Move slots
-	for _, e := range reshardTable {
-		// move slot
-		self.MoveSlot(e, target, opts)
+	if journal.Path() != "" {
+		logrus.Printf(">>> Recording the reshard progress in %s", journal.Path())
 	}
 
-	return nil
+	return resumeHint(self.RunJournal(journal, opts, nil), journal.Path())
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+// restore-host    host:port
+//                  --host <arg>
+//                  --state <arg>
+//                  --max-lag <arg>
+//                  --timeout <arg>
+var restoreHostCommand = cli.Command{
+	Name:      "restore-host",
+	Usage:     "move the masters back to an evacuated host.",
+	ArgsUsage: `host:port`,
+	Description: `The restore-host command fails the masters moved off the host by
+   evacuate back over to it, once they are in sync with the replicas
+   promoted in their place. The --state file is removed once every master
+   is back, and kept after a failure to run the command again.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "host",
+			Value: "",
+			Usage: `Address of the evacuated host.`,
+		},
+		cli.StringFlag{
+			Name:  "state",
+			Value: "",
+			Usage: `File written by evacuate, named after the host in the temporary directory by default.`,
+		},
+		cli.Int64Flag{
+			Name:  "max-lag",
+			Value: redistrib.FailoverDefaultMaxLag,
+			Usage: `Replication offset a replica may lag behind its master, -1 not to check it.`,
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: redistrib.FailoverDefaultTimeout,
+			Usage: `Time to wait for every node to see each failover.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 1 || context.String("host") == "" {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "restore-host")
+			return badArgument("Must provide \"--host host host:port\" for restore-host command!")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.RestoreHostClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) RestoreHostClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for restore-host command")
+	}
+	host := context.String("host")
+
+	evacuation, err := redistrib.LoadEvacuation(evacuationPath(context, host))
+	if err != nil {
+		return badArgument("%s", err)
+	}
+	if evacuation.Host != host {
+		return badArgument("The evacuation recorded is of %s, not %s", evacuation.Host, host)
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	logrus.Printf(">>> Restoring %d masters on %s", len(evacuation.Masters), host)
+	results, err := self.RestoreHost(evacuation, failoverOpts(context))
+	showFailovers(results)
+	return err
+}
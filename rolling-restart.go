@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+//  rolling-restart host:port
+//                  --hook <arg>
+//                  --timeout <arg>
+//                  --max-lag <arg>
+//                  --failover-timeout <arg>
+var rollingRestartCommand = cli.Command{
+	Name:      "rolling-restart",
+	Usage:     "restart the nodes of the redis cluster one at a time.",
+	ArgsUsage: `host:port`,
+	Description: `The rolling-restart command restarts the replicas, then the masters,
+   one at a time with the --hook shell command, where {host}, {port} and
+   {id} are replaced by the address and the ID of the node. A master is
+   failed over to a replica before its restart, and every node must be
+   back with cluster_state:ok and its replication link up before the next
+   one restarts. The command stops at the first failure.`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "hook",
+			Value: "",
+			Usage: `Shell command restarting a node, e.g. "ssh {host} systemctl restart redis@{port}".`,
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: redistrib.RestartDefaultTimeout,
+			Usage: `Time to wait for each node to rejoin the cluster.`,
+		},
+		cli.Int64Flag{
+			Name:  "max-lag",
+			Value: redistrib.FailoverDefaultMaxLag,
+			Usage: `Replication offset a replica may lag behind its master to be promoted, -1 not to check it.`,
+		},
+		cli.DurationFlag{
+			Name:  "failover-timeout",
+			Value: redistrib.FailoverDefaultTimeout,
+			Usage: `Time to wait for every node to see each failover.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 1 || context.String("hook") == "" {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "rolling-restart")
+			return badArgument("Must provide \"--hook command host:port\" for rolling-restart command!")
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.RollingRestartClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) RollingRestartClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for rolling-restart command")
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	// Only restart nodes of a healthy cluster.
+	if err := self.CheckCluster(true); err != nil {
+		return err
+	}
+	if len(self.SlotsProblems()) > 0 || len(self.Unreachable()) > 0 {
+		return redistrib.NewError(redistrib.ErrClusterUnhealthy, "", nil, "*** Please fix your cluster problem before restarting nodes.")
+	}
+
+	return self.RollingRestart(&redistrib.RestartOpts{
+		Hook: restartHook(context.String("hook")),
+		Failover: &redistrib.FailoverOpts{
+			Mode:    redistrib.FailoverDefault,
+			MaxLag:  context.Int64("max-lag"),
+			Timeout: context.Duration("failover-timeout"),
+		},
+		Timeout: context.Duration("timeout"),
+	})
+}
+
+// The hook running the shell command of the template for a node.
+func restartHook(template string) func(node *redistrib.ClusterNode) error {
+	return func(node *redistrib.ClusterNode) error {
+		cmd := strings.NewReplacer(
+			"{host}", node.Host(),
+			"{port}", strconv.FormatUint(uint64(node.Port()), 10),
+			"{id}", node.Name(),
+		).Replace(template)
+
+		if dryRun != nil {
+			logrus.Printf("Would run: %s", cmd)
+			return nil
+		}
+		logrus.Printf("Running: %s", cmd)
+		c := exec.Command("sh", "-c", cmd)
+		c.Stdout = os.Stderr
+		c.Stderr = os.Stderr
+		return c.Run()
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
 // set-timeout     host:port milliseconds
@@ -14,12 +15,13 @@ var setTimeoutCommand = cli.Command{
 	Name:        "set-timeout",
 	Usage:       "set timeout configure for redis cluster.",
 	ArgsUsage:   `host:port milliseconds`,
-	Description: `The set-timeout command set a timeout for redis cluster.`,
+	Description: `The set-timeout command set a timeout for redis cluster, like config-set
+   cluster-node-timeout with --rewrite.`,
 	Action: func(context *cli.Context) error {
 		if context.NArg() != 2 {
 			fmt.Printf("Incorrect Usage.\n\n")
 			cli.ShowCommandHelp(context, "set-timeout")
-			logrus.Fatalf("Must provide \"host:port milliseconds\" for set-timeout command!")
+			return badArgument("Must provide \"host:port milliseconds\" for set-timeout command!")
 		}
 
 		rt := NewRedisTrib()
@@ -40,36 +42,21 @@ func (self *RedisTrib) SetTimeoutClusterCmd(context *cli.Context) error {
 	timeout := context.Args().Get(1)
 	millisec, err := strconv.ParseInt(timeout, 0, 32)
 	if err != nil {
-		logrus.Fatalf("Please check the timeout format is number: %s", err.Error())
+		return badArgument("Please check the timeout format is number: %s", err.Error())
 	} else if millisec < 100 {
-		logrus.Fatalf("Setting a node timeout of less than 100 milliseconds is a bad idea.")
+		return badArgument("Setting a node timeout of less than 100 milliseconds is a bad idea.")
 	}
 
 	// Load cluster information
 	if err := self.LoadClusterInfoFromNode(addr); err != nil {
 		return err
 	}
-	okCount := 0
-	errCount := 0
-
-	// Send CLUSTER FORGET to all the nodes but the node to remove
 	logrus.Printf(">>> Reconfiguring node timeout in every cluster node...")
-
-	for _, node := range self.Nodes() {
-		if _, err := node.Call("CONFIG", "set", "cluster-node-timeout", millisec); err != nil {
-			logrus.Errorf("ERR setting node-timeot in set operation for %s: %s", node.String(), err.Error())
-			errCount += 1
-		} else {
-			if _, err := node.Call("CONFIG", "rewrite"); err != nil {
-				logrus.Errorf("ERR setting node-timeot in rewrite operation for %s: %s", node.String(), err.Error())
-				errCount += 1
-			} else {
-				logrus.Printf("*** New timeout set for %s", node.NodeString())
-				okCount += 1
-			}
-		}
+	params := []redistrib.ConfigParam{{Name: "cluster-node-timeout", Value: strconv.FormatInt(millisec, 10)}}
+	if err := self.SetConfig(self.Nodes(), params, true); err != nil {
+		return err
 	}
 
-	logrus.Printf(">>> New node timeout set. %d OK, %d ERR.", okCount, errCount)
+	logrus.Printf(">>> New node timeout set on %d nodes.", len(self.Nodes()))
 	return nil
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
+)
+
+//  slot-stats      host:port
+//                  --top <arg>
+//                  --pipeline <arg>
+//                  --output <arg>
+var slotStatsCommand = cli.Command{
+	Name:      "slot-stats",
+	Usage:     "show the distribution of the keys across the slots.",
+	ArgsUsage: `host:port`,
+	Description: `The slot-stats command counts the keys of every slot on its master, and
+   shows a histogram of the slots by number of keys, the heaviest slots and the
+   share of the keys of each master compared with its share of the slots. The
+   csv output lists the keys of every slot.`,
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "top",
+			Value: 10,
+			Usage: `Number of heaviest slots shown.`,
+		},
+		cli.IntFlag{
+			Name:  "pipeline",
+			Value: redistrib.SlotStatsDefaultPipeline,
+			Usage: `Slots counted per round trip.`,
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Value: "text",
+			Usage: `Output format: text, json or csv.`,
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if context.NArg() != 1 {
+			fmt.Printf("Incorrect Usage.\n\n")
+			cli.ShowCommandHelp(context, "slot-stats")
+			return badArgument("Must provide host:port for slot-stats command!")
+		}
+		switch format := context.String("output"); format {
+		case "text", "json", "csv":
+		default:
+			return badArgument("unknown output format %q", format)
+		}
+
+		rt := NewRedisTrib()
+		if err := rt.SlotStatsClusterCmd(context); err != nil {
+			return err
+		}
+		return nil
+	},
+}
+
+func (self *RedisTrib) SlotStatsClusterCmd(context *cli.Context) error {
+	var addr string
+
+	if addr = context.Args().Get(0); addr == "" {
+		return errors.New("please check host:port for slot-stats command")
+	}
+
+	if err := self.LoadClusterInfoFromNode(addr); err != nil {
+		return err
+	}
+
+	logrus.Printf(">>> Counting the keys of every slot...")
+	stats, err := self.SlotStats(context.Int("pipeline"), context.Int("top"))
+	if err != nil {
+		return err
+	}
+
+	switch context.String("output") {
+	case "json":
+		return writeOutput(os.Stdout, "json", stats)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"slot", "keys", "master"})
+		for _, s := range stats.Slots {
+			w.Write([]string{strconv.Itoa(s.Slot), strconv.Itoa(s.Keys), s.Master})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	logrus.Printf("%d keys in %d slots.", stats.Keys, len(stats.Slots))
+	logrus.Printf(">>> Slots by number of keys:")
+	for _, b := range stats.Histogram {
+		bucket := strconv.Itoa(b.Min)
+		if b.Max != b.Min {
+			bucket = fmt.Sprintf("%d-%d", b.Min, b.Max)
+		}
+		logrus.Printf("  %12s keys: %5d slots", bucket, b.Slots)
+	}
+	logrus.Printf(">>> Heaviest slots:")
+	for _, s := range stats.Top {
+		logrus.Printf("  slot %5d: %d keys on %s", s.Slot, s.Keys, s.Master)
+	}
+	logrus.Printf(">>> Share of keys and slots by master:")
+	for _, m := range stats.Masters {
+		logrus.Printf("  %s (%s...): %.2f%% of keys, %.2f%% of slots",
+			m.Addr, m.ID[0:8], m.KeyShare*100, m.SlotShare*100)
+	}
+	return nil
+}
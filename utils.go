@@ -3,203 +3,187 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"math"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/soarpenguin/redis-trib/redistrib"
 )
 
-// fatal prints the error's details if it is a libcontainer specific error type
-// then exits the program with an exit status of 1.
-func fatal(err error) {
-	// make sure the error is written to the logger
-	logrus.Error(err)
-	fmt.Fprintln(os.Stderr, err)
-	os.Exit(1)
+// RedisTrib adds the command line actions to the cluster manager of
+// the redistrib package.
+type RedisTrib struct {
+	*redistrib.RedisTrib
 }
 
-func Uniq(list []string) []string {
-	uniqset := make(map[string]bool, len(list))
-	for _, x := range list {
-		uniqset[x] = true
-	}
-	result := make([]string, 0, len(uniqset))
-	for x := range uniqset {
-		result = append(result, x)
+// Capture of the commands changing the cluster, set by --dry-run.
+var dryRun *redistrib.DryRun
+
+// Nodes dialed at once when loading the cluster, set by --workers.
+var discoveryWorkers = redistrib.DefaultDiscoveryWorkers
+
+func NewRedisTrib() *RedisTrib {
+	rt := &RedisTrib{redistrib.NewRedisTrib()}
+	rt.SetWorkers(discoveryWorkers)
+	rt.SetConfirm(confirm)
+	if dryRun != nil {
+		rt.SetDryRun(dryRun)
 	}
-	return result
+	return rt
 }
 
-func MergeNumArray2NumRange(array []int) string {
-	var i = 0
-	var result = ""
+// Ask the user to type 'yes', an ErrAborted error is returned otherwise.
+func confirm(msg string) error {
+	fmt.Printf("%s (type 'yes' to accept): ", msg)
 
-	for j, value := range array {
-		if j == len(array)-1 {
-			if i == j {
-				result += fmt.Sprintf("%d", array[j])
-			} else {
-				result += fmt.Sprintf("%d-%d", array[i], array[j])
-			}
-			break
-		}
+	reader := bufio.NewReader(os.Stdin)
+	text, _ := reader.ReadString('\n')
 
-		if value != array[j+1]-1 {
-			if j == i {
-				result += fmt.Sprintf("%d,", array[i])
-			} else {
-				result += fmt.Sprintf("%d-%d,", array[i], array[j])
-			}
-			i = j + 1
-		}
+	if !strings.EqualFold(strings.TrimSpace(text), "yes") {
+		return redistrib.NewError(redistrib.ErrAborted, "", nil, "*** Aborting...")
 	}
-
-	return result
+	return nil
 }
 
-func ToInterfaceArray(in []string) []interface{} {
-	result := make([]interface{}, len(in))
-
-	for i, val := range in {
-		result[i] = interface{}(val)
-	}
+// Exit status of the program for each kind of error, 1 for the others.
+var exitCodes = map[redistrib.ErrorKind]int{
+	redistrib.ErrBadArgument:      2,
+	redistrib.ErrBadAddress:       3,
+	redistrib.ErrConnection:       4,
+	redistrib.ErrNotClusterNode:   5,
+	redistrib.ErrNodeNotEmpty:     6,
+	redistrib.ErrClusterUnhealthy: 7,
+	redistrib.ErrSlotConflict:     8,
+	redistrib.ErrMigrate:          9,
+	redistrib.ErrAborted:          10,
+	redistrib.ErrConfig:           11,
+	redistrib.ErrFailover:         12,
+	redistrib.ErrRestart:          13,
+}
 
-	return result
+// exitStatus ends the program with the given status, the message is
+// printed unless empty.
+type exitStatus struct {
+	code int
+	msg  string
 }
 
-func ToStringArray(in []interface{}) []string {
-	result := make([]string, len(in))
+func (e *exitStatus) Error() string {
+	return e.msg
+}
 
-	for i, val := range in {
-		result[i] = fmt.Sprintf("%s", val)
+func exitCode(err error) int {
+	if s, ok := err.(*exitStatus); ok {
+		return s.code
 	}
-
-	return result
+	if code, ok := exitCodes[redistrib.KindOf(err)]; ok {
+		return code
+	}
+	return 1
 }
 
-func YesOrDie(msg string) {
-	fmt.Printf("%s (type 'yes' to accept): ", msg)
-
-	reader := bufio.NewReader(os.Stdin)
-	text, _ := reader.ReadString('\n')
-
-	if !strings.EqualFold(strings.TrimSpace(text), "yes") {
-		logrus.Fatalf("*** Aborting...")
+// fatal prints the error's details then exits the program with the exit
+// status matching its kind.
+func fatal(err error) {
+	if err.Error() == "" {
+		os.Exit(exitCode(err))
 	}
+	// make sure the error is written to the logger
+	logrus.Error(err)
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(exitCode(err))
 }
 
-func Round(num float64) int {
-	return int(num + math.Copysign(0.5, num))
+func badArgument(format string, args ...interface{}) error {
+	return redistrib.NewError(redistrib.ErrBadArgument, "", nil, format, args...)
 }
 
-func ClusterNodeArray2String(nodes [](*ClusterNode)) (result string) {
-	for _, node := range nodes {
-		if node != nil {
-			result += node.String() + ","
+func setupAuth(context *cli.Context) error {
+	auth := redistrib.DefaultAuth
+	auth.User = context.GlobalString("user")
+	auth.Password = context.GlobalString("password")
+
+	if path := context.GlobalString("password-file"); path != "" && auth.Password == "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read password file %s failed: %s", path, err)
 		}
+		auth.Password = strings.TrimRight(strings.SplitN(string(data), "\n", 2)[0], "\r")
 	}
 
-	if len(result) > 0 {
-		strings.TrimRight(result, ",")
+	if auth.User != "" && auth.Password == "" {
+		return fmt.Errorf("option --user requires a password")
 	}
+	return nil
+}
 
-	return result
+func setupTLS(context *cli.Context) error {
+	opts := redistrib.DefaultTLS
+	opts.Enabled = context.GlobalBool("tls")
+	opts.CACert = context.GlobalString("cacert")
+	opts.Cert = context.GlobalString("cert")
+	opts.Key = context.GlobalString("key")
+	opts.SNI = context.GlobalString("sni")
+	opts.Insecure = context.GlobalBool("insecure")
+	return opts.Load()
 }
 
-func NumArray2String(nums []int) (result string) {
-	if len(nums) > 0 {
-		result = fmt.Sprintf("%d", nums[0])
-		for _, id := range nums[1:] {
-			result += fmt.Sprintf("%s,%d", result, id)
-		}
-		if len(result) > 0 {
-			strings.TrimRight(result, ",")
-		}
+// Return the journal path given with --journal, or a new file in the
+// temporary directory named after the command.
+func journalPath(context *cli.Context, command string) string {
+	if dryRun != nil {
+		return ""
+	}
+	if path := context.String("journal"); path != "" {
+		return path
 	}
-	return result
+	name := fmt.Sprintf("redis-trib-%s-%d.journal", command, time.Now().Unix())
+	return filepath.Join(os.TempDir(), name)
 }
 
-/* CRC16 implementation according to CCITT standards.
- *
- * Note by @antirez: this is actually the XMODEM CRC 16 algorithm, using the
- * following parameters:
- *
- * Name                       : "XMODEM", also known as "ZMODEM", "CRC-16/ACORN"
- * Width                      : 16 bit
- * Poly                       : 1021 (That is actually x^16 + x^12 + x^5 + 1)
- * Initialization             : 0000
- * Reflect Input byte         : False
- * Reflect Output CRC         : False
- * Xor constant to output CRC : 0000
- * Output for "123456789"     : 31C3
- */
-
-var crc16tab = [...]uint16{
-	0x0000, 0x1021, 0x2042, 0x3063, 0x4084, 0x50a5, 0x60c6, 0x70e7,
-	0x8108, 0x9129, 0xa14a, 0xb16b, 0xc18c, 0xd1ad, 0xe1ce, 0xf1ef,
-	0x1231, 0x0210, 0x3273, 0x2252, 0x52b5, 0x4294, 0x72f7, 0x62d6,
-	0x9339, 0x8318, 0xb37b, 0xa35a, 0xd3bd, 0xc39c, 0xf3ff, 0xe3de,
-	0x2462, 0x3443, 0x0420, 0x1401, 0x64e6, 0x74c7, 0x44a4, 0x5485,
-	0xa56a, 0xb54b, 0x8528, 0x9509, 0xe5ee, 0xf5cf, 0xc5ac, 0xd58d,
-	0x3653, 0x2672, 0x1611, 0x0630, 0x76d7, 0x66f6, 0x5695, 0x46b4,
-	0xb75b, 0xa77a, 0x9719, 0x8738, 0xf7df, 0xe7fe, 0xd79d, 0xc7bc,
-	0x48c4, 0x58e5, 0x6886, 0x78a7, 0x0840, 0x1861, 0x2802, 0x3823,
-	0xc9cc, 0xd9ed, 0xe98e, 0xf9af, 0x8948, 0x9969, 0xa90a, 0xb92b,
-	0x5af5, 0x4ad4, 0x7ab7, 0x6a96, 0x1a71, 0x0a50, 0x3a33, 0x2a12,
-	0xdbfd, 0xcbdc, 0xfbbf, 0xeb9e, 0x9b79, 0x8b58, 0xbb3b, 0xab1a,
-	0x6ca6, 0x7c87, 0x4ce4, 0x5cc5, 0x2c22, 0x3c03, 0x0c60, 0x1c41,
-	0xedae, 0xfd8f, 0xcdec, 0xddcd, 0xad2a, 0xbd0b, 0x8d68, 0x9d49,
-	0x7e97, 0x6eb6, 0x5ed5, 0x4ef4, 0x3e13, 0x2e32, 0x1e51, 0x0e70,
-	0xff9f, 0xefbe, 0xdfdd, 0xcffc, 0xbf1b, 0xaf3a, 0x9f59, 0x8f78,
-	0x9188, 0x81a9, 0xb1ca, 0xa1eb, 0xd10c, 0xc12d, 0xf14e, 0xe16f,
-	0x1080, 0x00a1, 0x30c2, 0x20e3, 0x5004, 0x4025, 0x7046, 0x6067,
-	0x83b9, 0x9398, 0xa3fb, 0xb3da, 0xc33d, 0xd31c, 0xe37f, 0xf35e,
-	0x02b1, 0x1290, 0x22f3, 0x32d2, 0x4235, 0x5214, 0x6277, 0x7256,
-	0xb5ea, 0xa5cb, 0x95a8, 0x8589, 0xf56e, 0xe54f, 0xd52c, 0xc50d,
-	0x34e2, 0x24c3, 0x14a0, 0x0481, 0x7466, 0x6447, 0x5424, 0x4405,
-	0xa7db, 0xb7fa, 0x8799, 0x97b8, 0xe75f, 0xf77e, 0xc71d, 0xd73c,
-	0x26d3, 0x36f2, 0x0691, 0x16b0, 0x6657, 0x7676, 0x4615, 0x5634,
-	0xd94c, 0xc96d, 0xf90e, 0xe92f, 0x99c8, 0x89e9, 0xb98a, 0xa9ab,
-	0x5844, 0x4865, 0x7806, 0x6827, 0x18c0, 0x08e1, 0x3882, 0x28a3,
-	0xcb7d, 0xdb5c, 0xeb3f, 0xfb1e, 0x8bf9, 0x9bd8, 0xabbb, 0xbb9a,
-	0x4a75, 0x5a54, 0x6a37, 0x7a16, 0x0af1, 0x1ad0, 0x2ab3, 0x3a92,
-	0xfd2e, 0xed0f, 0xdd6c, 0xcd4d, 0xbdaa, 0xad8b, 0x9de8, 0x8dc9,
-	0x7c26, 0x6c07, 0x5c64, 0x4c45, 0x3ca2, 0x2c83, 0x1ce0, 0x0cc1,
-	0xef1f, 0xff3e, 0xcf5d, 0xdf7c, 0xaf9b, 0xbfba, 0x8fd9, 0x9ff8,
-	0x6e17, 0x7e36, 0x4e55, 0x5e74, 0x2e93, 0x3eb2, 0x0ed1, 0x1ef0,
+// Where evacuate records the masters moved off the host for restore-host,
+// --state or a file named after the host in the temporary directory.
+func evacuationPath(context *cli.Context, host string) string {
+	if path := context.String("state"); path != "" {
+		return path
+	}
+	name := fmt.Sprintf("redis-trib-evacuate-%s.json", host)
+	return filepath.Join(os.TempDir(), name)
 }
 
-func crc16(s string) uint16 {
-	var crc uint16
-	for i := 0; i < len(s); i++ {
-		b := s[i]
-		crc = (crc << 8) ^ crc16tab[byte(crc>>8)^b]
+// Tell the user how to pick up a slot migration that failed halfway. The
+// error keeps its kind, and so its exit status.
+func resumeHint(err error, path string) error {
+	if err == nil || path == "" {
+		return err
 	}
-	return crc
+	return redistrib.NewError(redistrib.KindOf(err), "", nil,
+		"%s\n*** Run the command again with --resume %s to finish it.", err, path)
 }
 
-const (
-	HASHTAG_START    = "{"
-	HASHTAG_END      = "}"
-	DEFAULT_SLOT_NUM = 16384
-)
+// The --weight node=weight options by full node name, the nodes must be
+// loaded first.
+func (self *RedisTrib) parseWeights(context *cli.Context, command string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, e := range context.StringSlice("weight") {
+		if e != "" && strings.Contains(e, "=") {
+			s := strings.Split(e, "=")
+			node := self.GetNodeByAbbreviatedName(s[0])
+			if node == nil || !node.HasFlag("master") {
+				return nil, badArgument("*** No such master node %s", s[0])
+			}
 
-// Turn a key name into the corrisponding Redis Cluster slot.
-func Key2Slot(key string) uint16 {
-	// Only hash what is inside {...} if there is such a pattern in the key.
-	// Note that the specification requires the content that is between
-	// the first { and the first } after the first {. If we found {} without
-	// nothing in the middle, the whole key is hashed as usually.
-	hashKey := key
-
-	start := strings.Index(key, HASHTAG_START)
-	if start >= 0 {
-		end := strings.LastIndex(key, HASHTAG_END)
-		if end >= 0 && start < end {
-			hashKey = key[start:end]
+			if w, err := strconv.Atoi(s[1]); err != nil {
+				return nil, badArgument("Invalid weight num for %s: %s=%v", command, s[0], s[1])
+			} else {
+				weights[node.Name()] = w
+			}
 		}
 	}
-
-	return crc16(hashKey) % DEFAULT_SLOT_NUM
+	return weights, nil
 }